@@ -0,0 +1,195 @@
+package pdnsprovider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+const (
+	acmeChallengeLabel = "_acme-challenge."
+
+	// challengeTTL is the TTL used for challenge TXT records.
+	challengeTTL = 60 * time.Second
+)
+
+// PresentChallenge publishes an ACME DNS-01 challenge TXT record for fqdn in
+// zone.  fqdn may be given with or without the _acme-challenge label, and
+// token is the unquoted TXT value (the key authorization digest).  Values
+// already present for the name are kept, so several challenges for the same
+// name can be outstanding at once.
+func (p *Provider) PresentChallenge(ctx context.Context, zone, fqdn, token string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	rec := challengeRecord(zone, fqdn, token)
+	k := challengeKey(zone, rec)
+
+	cs := p.challengeSet(zone)
+	defer cs.lock(k)()
+	if n := cs.count(k); n > 0 {
+		cs.setCount(k, n+1)
+		return nil
+	}
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	abs := convertNamesToAbsolute(zone, []libdns.Record{rec})[0]
+	fullZone, err := c.partialZone(ctx, zone, []libdns.Record{abs})
+	if err != nil {
+		return err
+	}
+	if hasValue(fullZone, abs.Name, abs.Type, abs.Value) {
+		// Someone else put it there, so it isn't ours to clean up.
+		return nil
+	}
+	_, err = p.AppendRecords(ctx, zone, []libdns.Record{rec})
+	if err != nil {
+		return err
+	}
+	cs.setCount(k, 1)
+	return nil
+}
+
+// CleanupChallenge removes a challenge record previously published with
+// PresentChallenge.  Only values added by this Provider are removed; values
+// that existed beforehand or were added by other processes are left alone.
+func (p *Provider) CleanupChallenge(ctx context.Context, zone, fqdn, token string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	rec := challengeRecord(zone, fqdn, token)
+	k := challengeKey(zone, rec)
+
+	cs := p.challengeSet(zone)
+	defer cs.lock(k)()
+	n := cs.count(k)
+	if n == 0 {
+		return nil
+	}
+	if n > 1 {
+		cs.setCount(k, n-1)
+		return nil
+	}
+	_, err := p.DeleteRecords(ctx, zone, []libdns.Record{rec})
+	if err != nil {
+		return err
+	}
+	cs.setCount(k, 0)
+	return nil
+}
+
+// challengeSet counts the ACME challenge values this Provider has
+// published in a zone and not yet cleaned up.  Presenting and cleaning up
+// a value hold its lock, so that they don't interleave, while challenges
+// with other values proceed in parallel and can share a batch.
+type challengeSet struct {
+	mu     sync.Mutex
+	counts map[string]int
+	locks  map[string]*challengeLock
+}
+
+// challengeLock is the lock of a challenge value, which is dropped once
+// nobody holds or waits for it.
+type challengeLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// challengeSet returns the challengeSet of zone.
+func (p *Provider) challengeSet(zone string) *challengeSet {
+	k := strings.ToLower(strings.TrimSuffix(zone, "."))
+	cs, _ := p.challenges.LoadOrStore(k, &challengeSet{
+		counts: make(map[string]int),
+		locks:  make(map[string]*challengeLock),
+	})
+	return cs.(*challengeSet)
+}
+
+// lock locks the challenge value k and returns the function unlocking it.
+func (cs *challengeSet) lock(k string) func() {
+	cs.mu.Lock()
+	l := cs.locks[k]
+	if l == nil {
+		l = &challengeLock{}
+		cs.locks[k] = l
+	}
+	l.users++
+	cs.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		cs.mu.Lock()
+		if l.users--; l.users == 0 {
+			delete(cs.locks, k)
+		}
+		cs.mu.Unlock()
+	}
+}
+
+func (cs *challengeSet) count(k string) int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.counts[k]
+}
+
+func (cs *challengeSet) setCount(k string, n int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if n == 0 {
+		delete(cs.counts, k)
+	} else {
+		cs.counts[k] = n
+	}
+}
+
+// challengeRecord builds the TXT record for an ACME challenge on fqdn.
+func challengeRecord(zone, fqdn, token string) libdns.Record {
+	zone = strings.TrimSuffix(zone, ".") + "."
+	name := strings.TrimSuffix(fqdn, ".")
+	// wildcard names are validated on their base name
+	name = strings.TrimPrefix(name, "*.")
+	if !strings.HasPrefix(strings.ToLower(name), acmeChallengeLabel) {
+		name = acmeChallengeLabel + name
+	}
+	return libdns.Record{
+		Type:  "TXT",
+		Name:  libdns.RelativeName(name+".", zone),
+		Value: quoteTXT(token),
+		TTL:   challengeTTL,
+	}
+}
+
+func challengeKey(zone string, rec libdns.Record) string {
+	return strings.ToLower(strings.TrimSuffix(zone, ".")) + "|" + key(rec.Name, rec.Value)
+}
+
+// quoteTXT turns a plain string into PowerDNS TXT content.  Values that are
+// already quoted are returned as is.
+func quoteTXT(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value
+	}
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func hasValue(fullZone *zones.Zone, name, rrType, value string) bool {
+	for _, rr := range fullZone.ResourceRecordSets {
+		if !strings.EqualFold(rr.Name, name) || rr.Type != rrType {
+			continue
+		}
+		for _, r := range rr.Records {
+			if r.Content == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package pdnsprovider
+
+import (
+	"testing"
+)
+
+func TestChallengeRecord(t *testing.T) {
+	for _, table := range []struct {
+		zone  string
+		fqdn  string
+		token string
+		name  string
+		value string
+	}{
+		{"example.org.", "www.example.org.", "abc", "_acme-challenge.www", `"abc"`},
+		{"example.org", "www.example.org", "abc", "_acme-challenge.www", `"abc"`},
+		{"example.org.", "_acme-challenge.example.org.", `"abc"`, "_acme-challenge", `"abc"`},
+		{"example.org.", "*.example.org.", "abc", "_acme-challenge", `"abc"`},
+		{"example.org.", "a.b.example.org.", `a"b`, "_acme-challenge.a.b", `"a\"b"`},
+	} {
+		rec := challengeRecord(table.zone, table.fqdn, table.token)
+		if rec.Type != "TXT" || rec.Name != table.name || rec.Value != table.value {
+			t.Errorf("challengeRecord(%q, %q, %q): have %s %s %s want TXT %s %s",
+				table.zone, table.fqdn, table.token, rec.Type, rec.Name, rec.Value, table.name, table.value)
+		}
+	}
+}
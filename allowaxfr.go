@@ -0,0 +1,48 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+const (
+	// allowAXFRKind is the zone metadata kind listing who may transfer
+	// the zone.
+	allowAXFRKind = "ALLOW-AXFR-FROM"
+
+	// AllowAXFRAutoNS is the ALLOW-AXFR-FROM entry that allows transfers
+	// from the addresses of the zone's NS records.
+	AllowAXFRAutoNS = "AUTO-NS"
+)
+
+// AllowAXFRFrom returns the ALLOW-AXFR-FROM entries of zone.
+func (p *Provider) AllowAXFRFrom(ctx context.Context, zone string) ([]string, error) {
+	return p.GetZoneMetadata(ctx, zone, allowAXFRKind)
+}
+
+// AddAllowAXFRFrom allows transfers of zone from entries, each of which is
+// an IP address, a network such as "192.0.2.0/24", or AllowAXFRAutoNS.
+func (p *Provider) AddAllowAXFRFrom(ctx context.Context, zone string, entries ...string) error {
+	for _, e := range entries {
+		if err := validateAXFREntry(e); err != nil {
+			return err
+		}
+	}
+	return p.editMetadata(ctx, zone, allowAXFRKind, entries, nil)
+}
+
+// RemoveAllowAXFRFrom removes entries from the ALLOW-AXFR-FROM list of zone.
+func (p *Provider) RemoveAllowAXFRFrom(ctx context.Context, zone string, entries ...string) error {
+	return p.editMetadata(ctx, zone, allowAXFRKind, nil, entries)
+}
+
+func validateAXFREntry(e string) error {
+	if e == AllowAXFRAutoNS || net.ParseIP(e) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(e); err != nil {
+		return fmt.Errorf("invalid ALLOW-AXFR-FROM entry %q: not an IP address, network or %s", e, AllowAXFRAutoNS)
+	}
+	return nil
+}
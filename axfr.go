@@ -0,0 +1,87 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the allowed clock skew for TSIG signed messages, in seconds.
+const tsigFudge = 300
+
+// tsig returns the fully qualified key name and algorithm to sign messages
+// with, or an empty key name if TSIG isn't configured.
+func (p *Provider) tsig() (keyName, algorithm string) {
+	if p.TSIGKeyName == "" {
+		return "", ""
+	}
+	algorithm = p.TSIGAlgorithm
+	if algorithm == "" {
+		algorithm = dns.HmacSHA256
+	}
+	return dns.Fqdn(p.TSIGKeyName), dns.Fqdn(algorithm)
+}
+
+// transferRecords lists the zone with an AXFR from AXFRServer, falling back
+// to DNSUpdateServer, and calls fn for every record received.
+func (p *Provider) transferRecords(ctx context.Context, zone string, fn func(libdns.Record) error) error {
+	if err := p.checkZone(zone); err != nil {
+		return err
+	}
+	zone = dns.Fqdn(zone)
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+	t := &dns.Transfer{}
+	if keyName, algorithm := p.tsig(); keyName != "" {
+		t.TsigSecret = map[string]string{keyName: p.TSIGSecret}
+		m.SetTsig(keyName, algorithm, tsigFudge, time.Now().Unix())
+	}
+	server := p.AXFRServer
+	if server == "" {
+		server = p.DNSUpdateServer
+	}
+	envelopes, err := t.In(m, server)
+	if err != nil {
+		return err
+	}
+	// keep draining so the transfer goroutine can finish
+	defer func() {
+		for range envelopes {
+		}
+	}()
+
+	soaSeen := false
+	for env := range envelopes {
+		if env.Error != nil {
+			return fmt.Errorf("zone transfer of %s failed: %s", zone, env.Error)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, rr := range env.RR {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeSOA {
+				// the transfer ends with a repeat of the SOA
+				if soaSeen {
+					continue
+				}
+				soaSeen = true
+			}
+			name, rrType, value := dns.CanonicalName(hdr.Name), dns.TypeToString[hdr.Rrtype], rdata(rr)
+			err := fn(libdns.Record{
+				ID:    recordID(name, rrType, value),
+				Type:  rrType,
+				Name:  libdns.RelativeName(name, zone),
+				Value: value,
+				TTL:   time.Duration(hdr.Ttl) * time.Second,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package pdnsprovider
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// pendingOp is a mutation waiting in a zone batch.
+type pendingOp struct {
+	op      Operation
+	records []libdns.Record
+	done    chan error
+
+	// result is set before done is signalled without an error
+	result []libdns.Record
+}
+
+// zoneBatch holds the mutations queued for a zone.
+type zoneBatch struct {
+	mu  sync.Mutex
+	ops []*pendingOp
+}
+
+// zoneBatch returns the batch of the zone with key k.
+func (p *Provider) zoneBatch(k string) *zoneBatch {
+	zb, _ := p.batches.LoadOrStore(k, &zoneBatch{})
+	return zb.(*zoneBatch)
+}
+
+// enqueue adds a mutation to the zone's current batch, starting a new batch
+// if there is none, and waits for the batch to be submitted.  If ctx is done
+// first the mutation may still be applied.
+func (p *Provider) enqueue(ctx context.Context, zone string, op Operation, records []libdns.Record) ([]libdns.Record, error) {
+	k := strings.ToLower(strings.TrimSuffix(zone, "."))
+	pending := &pendingOp{op: op, records: records, done: make(chan error, 1)}
+
+	zb := p.zoneBatch(k)
+	zb.mu.Lock()
+	if len(zb.ops) == 0 {
+		time.AfterFunc(p.BatchWindow, func() { p.flushBatch(zone, k) })
+	}
+	zb.ops = append(zb.ops, pending)
+	zb.mu.Unlock()
+
+	select {
+	case err := <-pending.done:
+		if err != nil {
+			return nil, err
+		}
+		return pending.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flushBatch applies the queued mutations of a zone in order and submits
+// the result as a single patch.  A mutation that can't be built fails on
+// its own, an error submitting the patch fails all of them.
+func (p *Provider) flushBatch(zone, k string) {
+	zb := p.zoneBatch(k)
+	zb.mu.Lock()
+	ops := zb.ops
+	zb.ops = nil
+	zb.mu.Unlock()
+
+	ctx, cancel := p.withDeadline(context.Background())
+	defer cancel()
+	errs := make([]error, len(ops))
+	err := p.submitBatch(ctx, zone, ops, errs)
+	for i, op := range ops {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+		op.done <- errs[i]
+	}
+}
+
+func (p *Provider) submitBatch(ctx context.Context, zone string, ops []*pendingOp, errs []error) error {
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	var all []libdns.Record
+	for _, op := range ops {
+		all = append(all, op.records...)
+	}
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, all))
+	if err != nil {
+		return err
+	}
+
+	// each mutation sees the changes of the ones queued before it
+	working := *fullZone
+	working.ResourceRecordSets = append([]zones.ResourceRecordSet(nil), fullZone.ResourceRecordSets...)
+	final := make(map[string]zones.ResourceRecordSet)
+	var order []string
+	for i, op := range ops {
+		rRSets, err := p.buildChanges(&working, zone, op.records, op.op)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		op.result = resultRecords(&working, rRSets, zone, op.records, op.op)
+		applyRRSets(&working, rRSets)
+		for _, rr := range rRSets {
+			k := key(rr.Name, rr.Type)
+			if _, ok := final[k]; !ok {
+				order = append(order, k)
+			}
+			final[k] = rr
+		}
+	}
+	if len(order) == 0 {
+		return nil
+	}
+	rRSets := make([]zones.ResourceRecordSet, 0, len(order))
+	for _, k := range order {
+		rRSets = append(rRSets, final[k])
+	}
+	if err := p.updateRRs(ctx, c, zone, fullZone.ID, rRSets); err != nil {
+		return err
+	}
+	p.countChanges(zone, fullZone, rRSets)
+	return nil
+}
+
+// applyRRSets applies rRSets to the RRsets of z, the way the server would.
+func applyRRSets(z *zones.Zone, rRSets []zones.ResourceRecordSet) {
+	for _, rr := range rRSets {
+		k := key(rr.Name, rr.Type)
+		out := z.ResourceRecordSets[:0:0]
+		for _, t := range z.ResourceRecordSets {
+			if key(t.Name, t.Type) != k {
+				out = append(out, t)
+			}
+		}
+		if rr.ChangeType != zones.ChangeTypeDelete && len(rr.Records) > 0 {
+			set := rr
+			set.ChangeType = 0
+			out = append(out, set)
+		}
+		z.ResourceRecordSets = out
+	}
+}
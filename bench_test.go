@@ -0,0 +1,162 @@
+package pdnsprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// syntheticZone builds a zone with n records spread over RRsets of up to
+// four values each.
+func syntheticZone(n int) *zones.Zone {
+	z := &zones.Zone{ID: "example.org.", Name: "example.org.", Serial: 1}
+	for i := 0; len(z.ResourceRecordSets)*4 < n; i++ {
+		rr := zones.ResourceRecordSet{
+			Name: fmt.Sprintf("host%d.example.org.", i),
+			Type: "A",
+			TTL:  300,
+		}
+		for j := 0; j < 4 && i*4+j < n; j++ {
+			rr.Records = append(rr.Records, zones.Record{
+				Content: fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff),
+			})
+		}
+		z.ResourceRecordSets = append(z.ResourceRecordSets, rr)
+	}
+	return z
+}
+
+// benchSizes are the zone sizes, in records, that the benchmarks run at.
+var benchSizes = []int{1000, 100000, 1000000}
+
+// syntheticRecords returns count absolute records that fall in the first
+// RRsets of syntheticZone, half of them new values, followed by count
+// records for RRsets that don't exist yet.
+func syntheticRecords(count int) []libdns.Record {
+	recs := make([]libdns.Record, 0, 2*count)
+	for i := 0; i < count; i++ {
+		recs = append(recs, libdns.Record{
+			Name:  fmt.Sprintf("host%d.example.org.", i/2),
+			Type:  "A",
+			Value: fmt.Sprintf("10.0.%d.%d", i>>8&0xff, i&0xff),
+			TTL:   300 * time.Second,
+		})
+	}
+	for i := 0; i < count; i++ {
+		recs = append(recs, libdns.Record{
+			Name:  fmt.Sprintf("new%d.example.org.", i),
+			Type:  "A",
+			Value: "192.0.2.1",
+			TTL:   300 * time.Second,
+		})
+	}
+	return recs
+}
+
+func syntheticZoneJSON(b *testing.B, n int) []byte {
+	data, err := json.Marshal(syntheticZone(n))
+	if err != nil {
+		b.Fatalf("failed to marshal zone: %s", err)
+	}
+	return data
+}
+
+// BenchmarkGetRecordsDecode compares decoding the whole zone before
+// converting it against converting RRsets as they are decoded.
+func BenchmarkGetRecordsDecode(b *testing.B) {
+	for _, n := range benchSizes {
+		data := syntheticZoneJSON(b, n)
+
+		b.Run(fmt.Sprintf("full/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var z zones.Zone
+				if err := json.Unmarshal(data, &z); err != nil {
+					b.Fatal(err)
+				}
+				recs := make([]libdns.Record, 0, len(z.ResourceRecordSets))
+				for _, rr := range z.ResourceRecordSets {
+					recs = appendLDRecords(recs, "example.org.", rr)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("stream/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var recs []libdns.Record
+				err := decodeRRSets(bytes.NewReader(data), func(rr zones.ResourceRecordSet) error {
+					recs = appendLDRecords(recs, "example.org.", rr)
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetRecordsConvert(b *testing.B) {
+	for _, n := range benchSizes {
+		z := syntheticZone(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			var recs []libdns.Record
+			for i := 0; i < b.N; i++ {
+				recs = recs[:0]
+				for _, rr := range z.ResourceRecordSets {
+					recs = appendLDRecords(recs, "example.org.", rr)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMakeLDRecHash(b *testing.B) {
+	for _, n := range benchSizes {
+		recs := make([]libdns.Record, 0, n)
+		for _, rr := range syntheticZone(n).ResourceRecordSets {
+			recs = appendLDRecords(recs, "", rr)
+		}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				makeLDRecHash(recs)
+			}
+		})
+	}
+}
+
+func BenchmarkMergeRRecs(b *testing.B) {
+	recs := syntheticRecords(100)
+	for _, n := range benchSizes {
+		z := syntheticZone(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := mergeRRecs(z, recs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCullRRecs(b *testing.B) {
+	recs := syntheticRecords(100)
+	for _, n := range benchSizes {
+		z := syntheticZone(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cullRRecs(z, recs)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the Provider's circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests without sending them.
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through to find out
+	// whether the API has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// defaultBreakerCooldown is how long the circuit stays open unless
+// Provider.BreakerCooldown says otherwise.
+const defaultBreakerCooldown = 30 * time.Second
+
+// CircuitOpenError is returned for requests that the circuit breaker
+// failed without sending them.
+type CircuitOpenError struct {
+	// Until is when the breaker will let a request through again.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("the PowerDNS API is failing, requests are suspended until %s", e.Until.Format(time.RFC3339))
+}
+
+// CircuitStats is a snapshot of the circuit breaker.
+type CircuitStats struct {
+	State CircuitState
+
+	// Failures is the number of consecutive failed requests.
+	Failures int
+
+	// Opened counts how many times the circuit has opened.
+	Opened int
+
+	// Rejected counts the requests failed while the circuit was open.
+	Rejected int
+
+	// Until is when an open circuit lets a trial request through.
+	Until time.Time
+}
+
+// CircuitStats returns the state of the circuit breaker.  The zero value
+// is returned when Provider.BreakerThreshold isn't set or the API hasn't
+// been used yet.  Zones routed through Endpoints have breakers of their
+// own, see EndpointCircuitStats.
+func (p *Provider) CircuitStats() CircuitStats {
+	p.mu.RLock()
+	b := p.breaker
+	p.mu.RUnlock()
+	if b == nil {
+		return CircuitStats{}
+	}
+	return b.stats()
+}
+
+// circuitBreaker fails requests fast after threshold consecutive
+// failures, until cooldown has passed.  Requests that fail with a
+// connection error or a 5xx or 429 status count as failures.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	s     CircuitStats
+	trial bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+func (b *circuitBreaker) stats() CircuitStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.s
+	if s.State == CircuitOpen && !b.now().Before(s.Until) {
+		s.State = CircuitHalfOpen
+	}
+	return s
+}
+
+// allow reports whether a request may be sent.  An open circuit lets one
+// trial request through once the cooldown has passed.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.s.State == CircuitOpen && !b.now().Before(b.s.Until) {
+		b.s.State = CircuitHalfOpen
+	}
+	switch b.s.State {
+	case CircuitOpen:
+		b.s.Rejected++
+		return &CircuitOpenError{Until: b.s.Until}
+	case CircuitHalfOpen:
+		if b.trial {
+			b.s.Rejected++
+			return &CircuitOpenError{Until: b.s.Until}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// done records the outcome of a request allow let through.
+func (b *circuitBreaker) done(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.s.State = CircuitClosed
+		b.s.Failures = 0
+		return
+	}
+	b.s.Failures++
+	if b.s.State == CircuitHalfOpen || b.s.Failures >= b.threshold {
+		if b.s.State != CircuitOpen {
+			b.s.Opened++
+		}
+		b.s.State = CircuitOpen
+		b.s.Until = b.now().Add(b.cooldown)
+	}
+}
+
+// release ends a request allow let through without recording an outcome.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.trial = false
+	b.mu.Unlock()
+}
+
+// breakerTransport sends requests through a circuit breaker.
+type breakerTransport struct {
+	breaker *circuitBreaker
+	base    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		if req.Context().Err() != nil {
+			// a cancelled request says nothing about the server
+			t.breaker.release()
+		} else {
+			t.breaker.done(true)
+		}
+		return resp, err
+	}
+	t.breaker.done(resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests)
+	return resp, nil
+}
@@ -0,0 +1,58 @@
+package pdnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// zoneCache holds the last full copy of each zone along with its ETag, so
+// that zones which haven't changed can be fetched with a conditional GET.
+type zoneCache struct {
+	mu    sync.RWMutex
+	zones map[string]cachedZone
+}
+
+type cachedZone struct {
+	etag string
+	zone *zones.Zone
+}
+
+// get fetches the zone, answering from the cache if the server reports it
+// unchanged.  The returned zone is shared and must not be modified.
+func (zc *zoneCache) get(ctx context.Context, c *client, zoneID string) (*zones.Zone, error) {
+	zc.mu.RLock()
+	cached, ok := zc.zones[zoneID]
+	zc.mu.RUnlock()
+
+	var header http.Header
+	if ok {
+		header = http.Header{"If-None-Match": {cached.etag}}
+	}
+	resp, err := c.requestWith(ctx, "GET", c.serverPath("zones", zoneID), nil, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return cached.zone, nil
+	}
+	var z zones.Zone
+	if err := json.NewDecoder(resp.Body).Decode(&z); err != nil {
+		return nil, err
+	}
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if zc.zones == nil {
+			zc.zones = make(map[string]cachedZone)
+		}
+		zc.zones[zoneID] = cachedZone{etag: etag, zone: &z}
+	} else {
+		delete(zc.zones, zoneID)
+	}
+	return &z, nil
+}
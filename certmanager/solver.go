@@ -0,0 +1,176 @@
+// Package certmanager exposes the PowerDNS provider as a cert-manager DNS01
+// webhook solver.
+//
+// Solver has the Name, Present and CleanUp methods of cert-manager's
+// webhook.Solver, with the challenge request reduced to the fields the
+// solver uses so this package doesn't pull in the Kubernetes libraries.  A
+// webhook binary wraps it in a few lines:
+//
+//	type solver struct{ s *certmanager.Solver }
+//
+//	func (s solver) Name() string { return s.s.Name() }
+//	func (s solver) Present(ch *v1alpha1.ChallengeRequest) error {
+//		return s.s.Present(&certmanager.ChallengeRequest{
+//			ResolvedFQDN: ch.ResolvedFQDN,
+//			ResolvedZone: ch.ResolvedZone,
+//			Key:          ch.Key,
+//			Config:       ch.Config.Raw,
+//		})
+//	}
+//	// CleanUp likewise, and Initialize returns nil.
+//
+//	cmd.RunWebhookServer(groupName, solver{&certmanager.Solver{}})
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/nathanejohnson/pdnsprovider"
+)
+
+// SolverName is the solver name issuers refer to in their webhook config.
+const SolverName = "powerdns"
+
+// challengeTTL is the TTL of the challenge TXT records.
+const challengeTTL = 60 * time.Second
+
+// ChallengeRequest holds the parts of a cert-manager challenge request used
+// by the solver.
+type ChallengeRequest struct {
+	// ResolvedFQDN is the fully qualified name of the TXT record,
+	// including the _acme-challenge label.
+	ResolvedFQDN string
+	// ResolvedZone is the zone the record is published in.
+	ResolvedZone string
+	// Key is the TXT record value.
+	Key string
+	// Config is the raw solver config from the issuer.
+	Config []byte
+}
+
+// Config is the per-issuer solver configuration.
+type Config struct {
+	ServerURL string `json:"server_url"`
+	ServerID  string `json:"server_id,omitempty"`
+	APIToken  string `json:"api_token,omitempty"`
+
+	// APITokenEnv names an environment variable to read the API token
+	// from, so that it can be mounted from a secret instead of being
+	// written into the issuer.
+	APITokenEnv string `json:"api_token_env,omitempty"`
+}
+
+// Solver presents and cleans up DNS01 challenges in PowerDNS.  The zero
+// value is ready to use.
+type Solver struct {
+	// Timeout bounds each Present and CleanUp call.  It defaults to one
+	// minute.
+	Timeout time.Duration
+
+	mu sync.Mutex
+	// providers are kept per config so that their connections are reused.
+	providers map[Config]*pdnsprovider.Provider
+}
+
+// Name returns SolverName.
+func (s *Solver) Name() string {
+	return SolverName
+}
+
+// Present publishes the challenge TXT record.  cert-manager may call it
+// again for a challenge that is already presented, which leaves the record
+// as it is.
+func (s *Solver) Present(ch *ChallengeRequest) error {
+	p, rec, err := s.challenge(ch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err = p.AppendRecords(ctx, ch.ResolvedZone, []libdns.Record{rec})
+	return err
+}
+
+// CleanUp removes the TXT value of the challenge.  Other values for the
+// same name are left in place.  It needs nothing from Present, so the
+// challenge can be cleaned up by another replica or after a restart.
+func (s *Solver) CleanUp(ch *ChallengeRequest) error {
+	p, rec, err := s.challenge(ch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	_, err = p.DeleteRecords(ctx, ch.ResolvedZone, []libdns.Record{rec})
+	return err
+}
+
+// challenge returns the provider for the issuer config of ch and the TXT
+// record holding its key, quoted as PowerDNS stores TXT values.  Keys are
+// base64url digests, which need no escaping beyond that.
+func (s *Solver) challenge(ch *ChallengeRequest) (*pdnsprovider.Provider, libdns.Record, error) {
+	if ch.Key == "" {
+		return nil, libdns.Record{}, fmt.Errorf("challenge for %s has no key", ch.ResolvedFQDN)
+	}
+	p, err := s.provider(ch)
+	if err != nil {
+		return nil, libdns.Record{}, err
+	}
+	zone := strings.TrimSuffix(ch.ResolvedZone, ".") + "."
+	fqdn := strings.TrimSuffix(ch.ResolvedFQDN, ".") + "."
+	rec := libdns.Record{
+		Type:  "TXT",
+		Name:  libdns.RelativeName(fqdn, zone),
+		Value: strconv.Quote(ch.Key),
+		TTL:   challengeTTL,
+	}
+	return p, rec, nil
+}
+
+func (s *Solver) context() (context.Context, context.CancelFunc) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (s *Solver) provider(ch *ChallengeRequest) (*pdnsprovider.Provider, error) {
+	var cfg Config
+	if len(ch.Config) > 0 {
+		if err := json.Unmarshal(ch.Config, &cfg); err != nil {
+			return nil, fmt.Errorf("error decoding solver config: %s", err)
+		}
+	}
+	if cfg.ServerURL == "" {
+		return nil, fmt.Errorf("solver config is missing server_url")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.providers[cfg]; ok {
+		return p, nil
+	}
+	token := cfg.APIToken
+	if cfg.APITokenEnv != "" {
+		token = os.Getenv(cfg.APITokenEnv)
+	}
+	p := &pdnsprovider.Provider{
+		ServerURL: cfg.ServerURL,
+		ServerID:  cfg.ServerID,
+		APIToken:  token,
+	}
+	if s.providers == nil {
+		s.providers = make(map[Config]*pdnsprovider.Provider)
+	}
+	s.providers[cfg] = p
+	return p, nil
+}
@@ -1,43 +1,287 @@
 package pdnsprovider
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/libdns/libdns"
 	pdns "github.com/mittwald/go-powerdns"
 	"github.com/mittwald/go-powerdns/apis/zones"
 )
 
+// ZoneClient is the subset of the go-powerdns zones API that the Provider
+// uses for record management.  Assigning a fake to Provider.ZoneClient lets
+// code built on the Provider be unit tested without a PowerDNS server.
+type ZoneClient interface {
+	ListZones(ctx context.Context, serverID string) ([]zones.Zone, error)
+	ListZone(ctx context.Context, serverID string, zoneName string) ([]zones.Zone, error)
+	GetZone(ctx context.Context, serverID, zoneID string) (*zones.Zone, error)
+	AddRecordSetToZone(ctx context.Context, serverID string, zoneID string, set zones.ResourceRecordSet) error
+}
+
 type client struct {
 	sID string
 	pdns.Client
+	zones ZoneClient
+
+	// view selects a zone variant, see Provider.View
+	view string
+
+	// flight deduplicates concurrent fullZone calls
+	flight zoneFlight
+
+	// zoneCache, when set, keeps full zones for conditional fetches
+	zoneCache *zoneCache
+
+	// missing, when set, remembers zones that weren't found
+	missing *missingZones
+
+	// updateWorkers, when above one, submits RRsets concurrently
+	updateWorkers int
+
+	// patchSize, when set, caps the RRsets sent in one patch
+	patchSize int
+
+	// readOnly refuses requests that change anything, see
+	// Provider.ReadOnly
+	readOnly bool
+
+	// direct is set when requests go straight to the API, so that zones
+	// can be fetched with rrset filters and patched in one request.  An
+	// injected ZoneClient supports neither.
+	direct bool
+
+	// used by do for endpoints go-powerdns doesn't cover
+	baseURL   string
+	apiPrefix string
+	apiKey    string
+	hc        *http.Client
+	debug     io.Writer
 }
 
 func newClient(ServerID, ServerURL, APIToken string, debug io.Writer) (*client, error) {
 	if debug == nil {
 		debug = ioutil.Discard
+	} else {
+		debug = &redactWriter{w: debug, secrets: []string{APIToken}}
 	}
+	hc := &http.Client{}
 	c, err := pdns.New(
 		pdns.WithBaseURL(ServerURL),
 		pdns.WithAPIKeyAuthentication(APIToken),
 		pdns.WithDebuggingOutput(debug),
+		pdns.WithHTTPClient(hc),
 	)
 	if err != nil {
 		return nil, err
 	}
 	return &client{
-		sID:    ServerID,
-		Client: c,
+		sID:       ServerID,
+		Client:    c,
+		zones:     c.Zones(),
+		direct:    true,
+		baseURL:   strings.TrimSuffix(ServerURL, "/"),
+		apiPrefix: defaultAPIPath,
+		apiKey:    APIToken,
+		hc:        hc,
+		debug:     debug,
 	}, nil
 }
 
+// normalizeServerURL checks that serverURL is an absolute http or https
+// URL and returns it without trailing slashes or the apiPath suffix, which
+// is added to every request.
+func normalizeServerURL(serverURL, apiPath string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q: %s", serverURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid server URL %q: it must start with http:// or https://, as in https://pdns.example.org:8081", serverURL)
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid server URL %q: it has no host name", serverURL)
+	}
+	if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return "", fmt.Errorf("invalid server URL %q: IPv6 addresses must be enclosed in brackets, as in https://[2001:db8::1]:8081", serverURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid server URL %q: it must not have a query or fragment, use APIPath for the path to the API", serverURL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	if strings.HasSuffix(u.Path, apiPath) {
+		u.Path = strings.TrimSuffix(u.Path, apiPath)
+	}
+	return u.String(), nil
+}
+
+// do sends a request to path below the API root.  in is sent as the JSON
+// request body and the JSON response is decoded into out, either may be nil.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := c.request(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// request is like do, but hands back the response for the caller to read
+// and close.  Responses with a non 2xx status are turned into errors.
+func (c *client) request(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	return c.requestWith(ctx, method, path, query, in, nil)
+}
+
+// requestWith is like request, with extra request headers.  A 304 response
+// to a request with If-None-Match is handed back rather than turned into an
+// error.
+func (c *client) requestWith(ctx context.Context, method, path string, query url.Values, in interface{}, header http.Header) (*http.Response, error) {
+	if c.readOnly && method != "GET" && method != "HEAD" {
+		return nil, &ReadOnlyError{Op: method + " " + path}
+	}
+	u := c.baseURL + c.apiPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	// asking for gzip ourselves means the transport leaves decoding to us,
+	// which works the same with custom transports
+	req.Header.Set("Accept-Encoding", "gzip")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(c.debug, "%s %s: %s\n", method, u, resp.Status)
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = &gzipBody{Reader: gz, body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.ContentLength = -1
+	}
+	if resp.StatusCode == http.StatusNotModified && req.Header.Get("If-None-Match") != "" {
+		return resp, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, newAPIError(method, path, resp.StatusCode, b)
+	}
+	return resp, nil
+}
+
+// gzipBody decompresses a response body and closes it along with the
+// decompressor.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// APIError is returned when the API answers with a non 2xx status.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+
+	// Message is the error the server reported, or the raw response
+	// body if it didn't send a JSON error.
+	Message string
+}
+
+func newAPIError(method, path string, status int, body []byte) *APIError {
+	e := &APIError{Method: method, Path: path, StatusCode: status}
+	var out struct {
+		Error  string   `json:"error"`
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &out) == nil && out.Error != "" {
+		e.Message = out.Error
+		if len(out.Errors) > 0 {
+			e.Message += ": " + strings.Join(out.Errors, "; ")
+		}
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+// serverPath returns the API path for the configured server followed by
+// elems, each of which is escaped.
+func (c *client) serverPath(elems ...string) string {
+	path := "/servers/" + url.PathEscape(c.sID)
+	for _, e := range elems {
+		path += "/" + url.PathEscape(e)
+	}
+	return path
+}
+
 func (c *client) updateRRs(ctx context.Context, zoneID string, recs []zones.ResourceRecordSet) error {
+	if c.readOnly {
+		// even when there is nothing to change, so that writes fail
+		// consistently
+		return &ReadOnlyError{Op: "update zone " + zoneID}
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+	if c.updateWorkers > 1 && len(recs) > 1 {
+		return c.updateConcurrently(ctx, zoneID, recs)
+	}
+	if c.direct && c.patchSize > 0 && len(recs) > c.patchSize {
+		return c.patchInChunks(ctx, zoneID, recs)
+	}
+	if c.direct {
+		// a single PATCH applies all of them atomically, and errors
+		// carry the server's explanation
+		return c.patchRRSets(ctx, zoneID, recs)
+	}
 	for _, rec := range recs {
-		err := c.Zones().AddRecordSetToZone(ctx, c.sID, zoneID, rec)
+		err := c.zones.AddRecordSetToZone(ctx, c.sID, zoneID, rec)
 		if err != nil {
 			return err
 		}
@@ -45,12 +289,128 @@ func (c *client) updateRRs(ctx context.Context, zoneID string, recs []zones.Reso
 	return nil
 }
 
+func (c *client) patchRRSets(ctx context.Context, zoneID string, recs []zones.ResourceRecordSet) error {
+	in := struct {
+		RRSets []zones.ResourceRecordSet `json:"rrsets"`
+	}{recs}
+	return c.do(ctx, "PATCH", c.serverPath("zones", zoneID), nil, in, nil)
+}
+
+// PartialUpdateError is returned when a change submitted in several
+// patches, see Provider.PatchSize, fails part way through.  The patches
+// before the failed one were applied, and the ones after it weren't sent.
+type PartialUpdateError struct {
+	// Applied, Failed and Pending are the RRsets of the applied patches,
+	// of the failed patch and of the patches not sent, in order.
+	Applied []zones.ResourceRecordSet
+	Failed  []zones.ResourceRecordSet
+	Pending []zones.ResourceRecordSet
+
+	// Patch is the number of the failed patch, counting from 1, out of
+	// Patches.
+	Patch, Patches int
+
+	Err error
+}
+
+func (e *PartialUpdateError) Error() string {
+	return fmt.Sprintf("patch %d of %d failed, %d RRsets were applied and %d not sent: %s", e.Patch, e.Patches, len(e.Applied), len(e.Pending), e.Err)
+}
+
+func (e *PartialUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// patchInChunks submits recs in order, in patches of at most c.patchSize
+// RRsets, and stops at the first patch that fails.
+func (c *client) patchInChunks(ctx context.Context, zoneID string, recs []zones.ResourceRecordSet) error {
+	patches := (len(recs) + c.patchSize - 1) / c.patchSize
+	for i := 0; i < len(recs); i += c.patchSize {
+		end := i + c.patchSize
+		if end > len(recs) {
+			end = len(recs)
+		}
+		if err := c.patchRRSets(ctx, zoneID, recs[i:end]); err != nil {
+			return &PartialUpdateError{
+				Applied: recs[:i],
+				Failed:  recs[i:end],
+				Pending: recs[end:],
+				Patch:   i/c.patchSize + 1,
+				Patches: patches,
+				Err:     err,
+			}
+		}
+	}
+	return nil
+}
+
+// updateConcurrently submits each RRset on its own, with up to
+// c.updateWorkers requests in flight.  The first error cancels the
+// remaining submissions and is returned.
+func (c *client) updateConcurrently(ctx context.Context, zoneID string, recs []zones.ResourceRecordSet) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan zones.ResourceRecordSet)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	workers := c.updateWorkers
+	if workers > len(recs) {
+		workers = len(recs)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range jobs {
+				var err error
+				if c.direct {
+					err = c.patchRRSets(ctx, zoneID, []zones.ResourceRecordSet{rec})
+				} else {
+					err = c.zones.AddRecordSetToZone(ctx, c.sID, zoneID, rec)
+				}
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for _, rec := range recs {
+		select {
+		case jobs <- rec:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// flushCache purges the entries for name from the packet cache.
+func (c *client) flushCache(ctx context.Context, name string) error {
+	q := url.Values{"domain": {name}}
+	return c.do(ctx, "PUT", c.serverPath("cache", "flush"), q, nil, nil)
+}
+
 func mergeRRecs(fullZone *zones.Zone, records []libdns.Record) ([]zones.ResourceRecordSet, error) {
 	// pdns doesn't really have an append functionality, so we have to fake it by
 	// fetching existing rrsets for the zone and see if any already exist.  If so,
 	// merge those with the existing data.  Otherwise just add the record.
 	inHash := makeLDRecHash(records)
-	var rrsets []zones.ResourceRecordSet
+	rrsets := make([]zones.ResourceRecordSet, 0, len(inHash))
+	// one set of seen values, cleared for each RRset
+	dupes := make(map[string]bool)
 	// Merge existing resource record sets with any that were passed in to modify.
 	for _, t := range fullZone.ResourceRecordSets {
 		k := key(t.Name, t.Type)
@@ -61,11 +421,14 @@ func mergeRRecs(fullZone *zones.Zone, records []libdns.Record) ([]zones.Resource
 				TTL:        int(recs[0].TTL.Seconds()),
 				ChangeType: zones.ChangeTypeReplace,
 				Comments:   t.Comments,
-				Records:    make([]zones.Record, len(t.Records)),
+				Records:    make([]zones.Record, len(t.Records), len(t.Records)+len(recs)),
 			}
+			// keep the existing values in order, with their flags
 			copy(rr.Records, t.Records)
 			// squash duplicate values
-			dupes := make(map[string]bool)
+			for v := range dupes {
+				delete(dupes, v)
+			}
 			for _, prec := range t.Records {
 				dupes[prec.Content] = true
 			}
@@ -83,14 +446,14 @@ func mergeRRecs(fullZone *zones.Zone, records []libdns.Record) ([]zones.Resource
 		}
 	}
 	// Any remaining in our input hash need to be straight adds / creates.
-	rrsets = append(rrsets, convertLDHash(inHash)...)
+	rrsets = appendLDHash(rrsets, inHash)
 	return rrsets, nil
 }
 
 // generate RessourceRecordSets that will delete records from zone
 func cullRRecs(fullZone *zones.Zone, records []libdns.Record) []zones.ResourceRecordSet {
 	inHash := makeLDRecHash(records)
-	var rRSets []zones.ResourceRecordSet
+	rRSets := make([]zones.ResourceRecordSet, 0, len(inHash))
 	for _, t := range fullZone.ResourceRecordSets {
 		k := key(t.Name, t.Type)
 		if recs, ok := inHash[k]; ok && len(recs) > 0 {
@@ -107,26 +470,102 @@ func cullRRecs(fullZone *zones.Zone, records []libdns.Record) []zones.ResourceRe
 
 }
 
-// remove culls from rRSet record values
+// remove culls from rRSet record values.  A cull with an empty value
+// removes every value.
 func removeRecords(rRSet zones.ResourceRecordSet, culls []libdns.Record) zones.ResourceRecordSet {
-	deleteItem := func(item string) []zones.Record {
-		recs := rRSet.Records
-		for i := len(recs) - 1; i >= 0; i-- {
-			if recs[i].Content == item {
-				copy(recs[i:], recs[:i+1])
-				recs = recs[:len(recs)-1]
-			}
+	// build a fresh slice so the caller's zone data is left untouched
+	recs := make([]zones.Record, 0, len(rRSet.Records))
+	for _, rec := range rRSet.Records {
+		if !culled(rec.Content, culls) {
+			recs = append(recs, rec)
 		}
-		return recs
 	}
+	rRSet.Records = recs
+	return rRSet
+}
+
+// culled reports whether content is removed by culls.  There are rarely
+// more than a few culls, so scanning them is cheaper than hashing.
+func culled(content string, culls []libdns.Record) bool {
 	for _, c := range culls {
-		rRSet.Records = deleteItem(c.Value)
+		if c.Value == content || c.Value == "" {
+			return true
+		}
 	}
-	return rRSet
+	return false
+}
+
+// generate ResourceRecordSets that replace each RRset named in records with
+// exactly the values given for it.  Values missing from records are removed,
+// and an RRset named only by records with an empty value is deleted.  All
+// other RRsets in the zone are untouched.
+func replaceRRecs(fullZone *zones.Zone, records []libdns.Record) []zones.ResourceRecordSet {
+	values := make([]libdns.Record, 0, len(records))
+	var clears []libdns.Record
+	for _, rec := range records {
+		if rec.Value == "" {
+			clears = append(clears, rec)
+		} else {
+			values = append(values, rec)
+		}
+	}
+	inHash := makeLDRecHash(values)
+	rRSets := convertLDHash(inHash)
+	keepDisabled(fullZone, rRSets)
+
+	var existing map[string]*zones.ResourceRecordSet
+	if fullZone != nil {
+		existing = make(map[string]*zones.ResourceRecordSet, len(fullZone.ResourceRecordSets))
+		for i := range fullZone.ResourceRecordSets {
+			t := &fullZone.ResourceRecordSets[i]
+			existing[key(t.Name, t.Type)] = t
+		}
+	}
+	for _, rec := range clears {
+		k := key(rec.Name, rec.Type)
+		if _, ok := inHash[k]; ok {
+			continue
+		}
+		// mark it so that the RRset is only deleted once
+		inHash[k] = nil
+		if _, ok := existing[k]; ok || fullZone == nil {
+			rRSets = append(rRSets, zones.ResourceRecordSet{
+				Name:       rec.Name,
+				Type:       rec.Type,
+				ChangeType: zones.ChangeTypeDelete,
+			})
+		}
+	}
+	return rRSets
+}
+
+// sameValues reports whether a and b have the same TTL and the same values,
+// in any order.
+func sameValues(a, b zones.ResourceRecordSet) bool {
+	if a.TTL != b.TTL || len(a.Records) != len(b.Records) {
+		return false
+	}
+	want := make(map[zones.Record]bool, len(a.Records))
+	for _, r := range a.Records {
+		want[r] = true
+	}
+	for _, r := range b.Records {
+		if !want[r] {
+			return false
+		}
+	}
+	return true
 }
 
 func convertLDHash(inHash map[string][]libdns.Record) []zones.ResourceRecordSet {
-	var rrsets []zones.ResourceRecordSet
+	return appendLDHash(make([]zones.ResourceRecordSet, 0, len(inHash)), inHash)
+}
+
+// appendLDHash appends the RRsets for the grouped records in inHash to
+// rrsets.
+func appendLDHash(rrsets []zones.ResourceRecordSet, inHash map[string][]libdns.Record) []zones.ResourceRecordSet {
+	// one set of seen values, cleared for each RRset
+	var dupes map[string]bool
 	for _, recs := range inHash {
 		if len(recs) == 0 {
 			continue
@@ -137,8 +576,25 @@ func convertLDHash(inHash map[string][]libdns.Record) []zones.ResourceRecordSet
 			Type:       recs[0].Type,
 			TTL:        int(recs[0].TTL.Seconds()),
 			ChangeType: zones.ChangeTypeReplace,
+			Records:    make([]zones.Record, 0, len(recs)),
+		}
+		if len(recs) == 1 {
+			rr.Records = append(rr.Records, zones.Record{Content: recs[0].Value})
+			rrsets = append(rrsets, rr)
+			continue
+		}
+		// pdns rejects RRsets containing the same value twice
+		if dupes == nil {
+			dupes = make(map[string]bool)
+		}
+		for v := range dupes {
+			delete(dupes, v)
 		}
 		for _, rec := range recs {
+			if dupes[rec.Value] {
+				continue
+			}
+			dupes[rec.Value] = true
 			rr.Records = append(rr.Records, zones.Record{
 				Content: rec.Value,
 			})
@@ -153,41 +609,189 @@ func key(Name, Type string) string {
 }
 
 func makeLDRecHash(records []libdns.Record) map[string][]libdns.Record {
-	// Keep track of records grouped by name + type
-	inHash := make(map[string][]libdns.Record)
-
+	// Keep track of records grouped by name + type.  Groups are found with
+	// a struct key, which unlike key() doesn't allocate, and share one
+	// backing array.
+	type nameType struct{ name, rrType string }
+	idx := make(map[nameType]int)
+	var counts []int
+	for _, r := range records {
+		nt := nameType{r.Name, r.Type}
+		i, ok := idx[nt]
+		if !ok {
+			i = len(counts)
+			idx[nt] = i
+			counts = append(counts, 0)
+		}
+		counts[i]++
+	}
+	backing := make([]libdns.Record, len(records))
+	groups := make([][]libdns.Record, len(counts))
+	off := 0
+	for i, n := range counts {
+		groups[i] = backing[off : off : off+n]
+		off += n
+	}
 	for _, r := range records {
-		k := key(r.Name, r.Type)
-		inHash[k] = append(inHash[k], r)
+		i := idx[nameType{r.Name, r.Type}]
+		groups[i] = append(groups[i], r)
+	}
+	inHash := make(map[string][]libdns.Record, len(groups))
+	for _, g := range groups {
+		inHash[key(g[0].Name, g[0].Type)] = g
 	}
 	return inHash
 }
 
+// fullZone fetches the zone with all of its RRsets.  Concurrent calls for
+// the same zone share a single fetch, so the result must not be modified.
 func (c *client) fullZone(ctx context.Context, zoneName string) (*zones.Zone, error) {
-	zc := c.Zones()
-	shortZone, err := c.shortZone(ctx, zoneName)
+	k := strings.ToLower(c.variantName(zoneName))
+	return c.flight.do(ctx, k, func(ctx context.Context) (*zones.Zone, error) {
+		zc := c.zones
+		shortZone, err := c.healthyZone(ctx, zoneName)
+		if err != nil {
+			return nil, err
+		}
+		if c.direct && c.zoneCache != nil {
+			return c.zoneCache.get(ctx, c, shortZone.ID)
+		}
+		fullZone, err := zc.GetZone(ctx, c.sID, shortZone.ID)
+		if err != nil {
+			return nil, err
+		}
+		return fullZone, nil
+	})
+}
+
+// partialZoneLimit is the largest number of RRsets partialZone fetches
+// individually before it falls back to fetching the whole zone.
+const partialZoneLimit = 8
+
+// partialZone returns the zone with only the RRsets that records refer to,
+// along with the DNAMEs that checkDNAME needs, using the rrset_name and
+// rrset_type filters of the zone endpoint.  Servers that don't understand
+// the filters return the whole zone, which is pared down here as well.
+func (c *client) partialZone(ctx context.Context, zoneName string, records []libdns.Record) (*zones.Zone, error) {
+	inHash := makeLDRecHash(records)
+	if !c.direct || len(inHash) > partialZoneLimit {
+		return c.fullZone(ctx, zoneName)
+	}
+	for _, rec := range records {
+		if rec.Type == "DNAME" {
+			// checkDNAME needs to see the names below it
+			return c.fullZone(ctx, zoneName)
+		}
+	}
+	// checkDNAME needs the DNAMEs above each name, and next to CNAMEs
+	apex := strings.ToLower(strings.TrimSuffix(zoneName, ".") + ".")
+	dnames := make(map[string]bool)
+	for _, recs := range inHash {
+		name := strings.ToLower(recs[0].Name)
+		if recs[0].Type == "CNAME" {
+			dnames[name] = true
+		}
+		for name != apex && strings.HasSuffix(name, "."+apex) {
+			name = name[strings.Index(name, ".")+1:]
+			dnames[name] = true
+		}
+	}
+	if len(inHash)+len(dnames) > partialZoneLimit {
+		return c.fullZone(ctx, zoneName)
+	}
+	shortZone, err := c.healthyZone(ctx, zoneName)
 	if err != nil {
 		return nil, err
 	}
-	fullZone, err := zc.GetZone(ctx, c.sID, shortZone.ID)
+	out := *shortZone
+	out.ResourceRecordSets = nil
+	fetch := func(name, rrType string) error {
+		rr, err := c.getRRSet(ctx, shortZone.ID, name, rrType)
+		if err != nil {
+			return err
+		}
+		if rr != nil {
+			out.ResourceRecordSets = append(out.ResourceRecordSets, *rr)
+		}
+		return nil
+	}
+	for _, recs := range inHash {
+		if err := fetch(recs[0].Name, recs[0].Type); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(dnames))
+	for name := range dnames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := fetch(name, "DNAME"); err != nil {
+			return nil, err
+		}
+	}
+	return &out, nil
+}
+
+// getRRSet fetches a single RRset with the API's rrset filters.  It returns
+// nil if the RRset doesn't exist.
+func (c *client) getRRSet(ctx context.Context, zoneID, name, rrType string) (*zones.ResourceRecordSet, error) {
+	q := url.Values{
+		"rrset_name": {name},
+		"rrset_type": {rrType},
+	}
+	var z zones.Zone
+	err := c.do(ctx, "GET", c.serverPath("zones", zoneID), q, nil, &z)
 	if err != nil {
 		return nil, err
 	}
-	return fullZone, nil
+	k := key(name, rrType)
+	for _, rr := range z.ResourceRecordSets {
+		if key(rr.Name, rr.Type) == k {
+			return &rr, nil
+		}
+	}
+	return nil, nil
 }
 
 func (c *client) shortZone(ctx context.Context, zoneName string) (*zones.Zone, error) {
-	zc := c.Zones()
-	shortZones, err := zc.ListZone(ctx, c.sID, zoneName)
+	zc := c.zones
+	name := c.variantName(zoneName)
+	if c.missing.has(name) {
+		return nil, fmt.Errorf("zone not found")
+	}
+	shortZones, err := zc.ListZone(ctx, c.sID, name)
 	if err != nil {
 		return nil, err
 	}
 	if len(shortZones) != 1 {
+		c.missing.add(name)
 		return nil, fmt.Errorf("zone not found")
 	}
 	return &shortZones[0], nil
 }
 
+// findZone walks up the labels of fqdn and returns the name of the closest
+// enclosing zone hosted on the server.
+func (c *client) findZone(ctx context.Context, fqdn string) (string, error) {
+	name := strings.TrimSuffix(fqdn, ".") + "."
+	for name != "." && name != "" {
+		if !c.missing.has(name) {
+			shortZones, err := c.zones.ListZone(ctx, c.sID, name)
+			if err != nil {
+				return "", err
+			}
+			if len(shortZones) == 1 {
+				return shortZones[0].Name, nil
+			}
+			c.missing.add(name)
+		}
+		i := strings.Index(name, ".")
+		name = name[i+1:]
+	}
+	return "", fmt.Errorf("no zone found for %s", fqdn)
+}
+
 func (c *client) zoneID(ctx context.Context, zoneName string) (string, error) {
 	shortZone, err := c.shortZone(ctx, zoneName)
 	if err != nil {
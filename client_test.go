@@ -3,11 +3,15 @@ package pdnsprovider
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,39 +20,42 @@ import (
 )
 
 func TestPDNSClient(t *testing.T) {
-	var dockerCompose string
-	var ok bool
 	doRun, _ := strconv.ParseBool(os.Getenv("PDNS_RUN_INTEGRATION_TEST"))
 	if !doRun {
 		t.Skip("skipping because PDNS_RUN_INTEGRATION_TEST was not set")
 	}
-	if dockerCompose, ok = which("docker-compose"); !ok {
+	compose, ok := composeCommand()
+	if !ok {
 		t.Skip("docker-compose is not present, skipping")
 	}
-	err := runCmd(dockerCompose, "rm", "-sfv")
-	if err != nil {
-		t.Fatalf("docker-compose failed: %s", err)
-	}
-	err = runCmd(dockerCompose, "down", "-v")
+	err := runCmd(compose, "rm", "-sfv")
 	if err != nil {
 		t.Fatalf("docker-compose failed: %s", err)
 	}
+	err = runCmd(compose, "down", "-v")
 	if err != nil {
 		t.Fatalf("docker-compose failed: %s", err)
 	}
 
-	err = runCmd(dockerCompose, "up", "-d")
+	err = runCmd(compose, "up", "-d")
 	defer func() {
 		if skipCleanup, _ := strconv.ParseBool(os.Getenv("PDNS_SKIP_CLEANUP")); !skipCleanup {
-			runCmd(dockerCompose, "down", "-v")
+			runCmd(compose, "down", "-v")
 		}
 	}()
+	if err != nil {
+		t.Fatalf("docker-compose failed: %s", err)
+	}
 	c, err := newClient("localhost", "http://localhost:8081", "secret", nil)
 	if err != nil {
 		t.Fatalf("failed client create: %s", err)
 	}
 
-	time.Sleep(time.Second * 30) // give everything time to finish coming up
+	// give everything time to finish coming up
+	err = waitForAPI(c, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("powerdns did not come up: %s", err)
+	}
 	z := zones.Zone{
 		Name: "example.org.",
 		Type: zones.ZoneTypeZone,
@@ -255,6 +262,84 @@ func TestPDNSClient(t *testing.T) {
 		})
 	}
 
+	t.Run("Test Plan", func(t *testing.T) {
+		changes, err := p.PlanChanges(context.Background(), "example.org.", []libdns.Record{
+			{Name: "3", Type: "A", Value: "127.0.0.10", TTL: time.Minute},
+			{Name: "4", Type: "A", Value: "127.0.0.11", TTL: time.Minute},
+		}, OperationAppend)
+		if err != nil {
+			t.Fatalf("failed to plan changes: %s", err)
+		}
+		kinds := make(map[string]ChangeKind)
+		for _, ch := range changes {
+			kinds[ch.RRSet.Name] = ch.Kind
+		}
+		want := map[string]ChangeKind{"3.example.org.": ChangeReplace, "4.example.org.": ChangeAdd}
+		if !reflect.DeepEqual(kinds, want) {
+			t.Errorf("assertion failed: have: %#v want %#v", kinds, want)
+		}
+	})
+
+	t.Run("Test ACME Challenge", func(t *testing.T) {
+		ctx := context.Background()
+		err := p.PresentChallenge(ctx, "example.org.", "www.example.org.", "token-1")
+		if err != nil {
+			t.Fatalf("failed to present challenge: %s", err)
+		}
+		err = p.PresentChallenge(ctx, "example.org.", "www.example.org.", "token-2")
+		if err != nil {
+			t.Fatalf("failed to present challenge: %s", err)
+		}
+		err = p.CleanupChallenge(ctx, "example.org.", "www.example.org.", "token-1")
+		if err != nil {
+			t.Fatalf("failed to clean up challenge: %s", err)
+		}
+		recs, err := p.GetRecords(ctx, "example.org.")
+		if err != nil {
+			t.Fatalf("error fetching zone: %s", err)
+		}
+		var have []string
+		for _, rr := range recs {
+			if rr.Name == "_acme-challenge.www" {
+				have = append(have, rr.Value)
+			}
+		}
+		want := []string{`"token-2"`}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("assertion failed: have: %#v want %#v", have, want)
+		}
+	})
+
+}
+
+// waitForAPI polls the server until it answers API requests or timeout
+// elapses.
+func waitForAPI(c *client, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		_, err := c.Zones().ListZones(ctx, c.sID)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// composeCommand returns the docker-compose binary, falling back to the
+// "docker compose" plugin.
+func composeCommand() ([]string, bool) {
+	if dc, ok := which("docker-compose"); ok {
+		return []string{dc}, true
+	}
+	if d, ok := which("docker"); ok && exec.Command(d, "compose", "version").Run() == nil {
+		return []string{d, "compose"}, true
+	}
+	return nil, false
 }
 
 func which(cmd string) (string, bool) {
@@ -265,9 +350,97 @@ func which(cmd string) (string, bool) {
 	return pth, true
 }
 
-func runCmd(cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
+func runCmd(cmd []string, args ...string) error {
+	c := exec.Command(cmd[0], append(cmd[1:], args...)...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	return c.Run()
 }
+
+func TestNormalizeServerURL(t *testing.T) {
+	for _, table := range []struct {
+		in, want string
+		err      bool
+	}{
+		{in: "http://localhost:8081", want: "http://localhost:8081"},
+		{in: "http://localhost:8081/", want: "http://localhost:8081"},
+		{in: "https://pdns.example.org/api/v1", want: "https://pdns.example.org"},
+		{in: "https://pdns.example.org/api/v1/", want: "https://pdns.example.org"},
+		{in: "https://example.org/pdns//", want: "https://example.org/pdns"},
+		{in: "https://example.org/pdns/api/v1", want: "https://example.org/pdns"},
+		{in: " http://localhost ", want: "http://localhost"},
+		{in: "https://[2001:db8::1]:8081/", want: "https://[2001:db8::1]:8081"},
+		{in: "http://[::1]/api/v1", want: "http://[::1]"},
+		{in: "http://[fe80::1%25eth0]:8081", want: "http://[fe80::1%25eth0]:8081"},
+		{in: "http://2001:db8::1:8081", err: true},
+		{in: "localhost:8081", err: true},
+		{in: "pdns.example.org", err: true},
+		{in: "ftp://pdns.example.org", err: true},
+		{in: "http://", err: true},
+		{in: "http://:8081", err: true},
+		{in: "http://pdns.example.org/?x=1", err: true},
+		{in: "http://pdns example.org", err: true},
+		{in: "", err: true},
+	} {
+		got, err := normalizeServerURL(table.in, defaultAPIPath)
+		if table.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", table.in, got)
+			}
+			continue
+		}
+		if err != nil || got != table.want {
+			t.Errorf("%q: got %q, %v, expected %q", table.in, got, err, table.want)
+		}
+	}
+}
+
+func TestProviderServerURL(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.ServerURL = fs.URL + "/api/v1/"
+	if _, err := p.GetRecords(context.Background(), "example.org."); err != nil {
+		t.Errorf("ServerURL with the API path: %s", err)
+	}
+
+	p = &Provider{ServerURL: "pdns.example.org:8081"}
+	_, err := p.GetRecords(context.Background(), "example.org.")
+	if err == nil || !strings.Contains(err.Error(), "http://") {
+		t.Errorf("expected an error about the scheme, got %v", err)
+	}
+}
+
+func TestProviderIPv6ServerURL(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %s", err)
+	}
+	fs := newFakeServer(t, testZone())
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(fs.serveHTTP))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	if !strings.HasPrefix(srv.URL, "http://[::1]:") {
+		t.Fatalf("unexpected server URL %s", srv.URL)
+	}
+
+	ctx := context.Background()
+	for _, p := range []*Provider{
+		{ServerURL: srv.URL},
+		{ServerURL: srv.URL + "/api/v1/"},
+		{ServerURL: srv.URL, MaxIdleConnsPerHost: 8, DisableKeepAlives: true},
+		{ServerURL: srv.URL, APIPath: "/api/v1", Retries: 1, BreakerThreshold: 3},
+		{ServerURL: srv.URL, Resolver: &net.Resolver{PreferGo: true}},
+	} {
+		p.APIToken = fakeAPIKey
+		if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+			t.Errorf("%+v: %s", p, err)
+			continue
+		}
+		_, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "v6", Type: "AAAA", Value: "2001:db8::1", TTL: time.Hour}})
+		if err != nil {
+			t.Errorf("%+v: %s", p, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Command pdnsdns exercises the PowerDNS libdns provider from the command
+// line.
+//
+// Usage:
+//
+//	pdnsdns [flags] list-zones
+//	pdnsdns [flags] get <zone>
+//	pdnsdns [flags] append|set|delete <zone> <record>...
+//	pdnsdns [flags] diff <zone> <record>...
+//
+// Records are given in zone file order, one per argument, with the name
+// relative to the zone:
+//
+//	pdnsdns append example.org. "_acme-challenge 60 TXT \"token\""
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	"github.com/nathanejohnson/pdnsprovider"
+)
+
+// jsonRecord is the JSON representation of a libdns.Record.
+type jsonRecord struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   int    `json:"ttl"`
+	Value string `json:"value"`
+}
+
+func main() {
+	fs := flag.NewFlagSet("pdnsdns", flag.ExitOnError)
+	serverURL := fs.String("server", os.Getenv("PDNS_SERVER_URL"), "PowerDNS API URL (env PDNS_SERVER_URL)")
+	serverID := fs.String("server-id", os.Getenv("PDNS_SERVER_ID"), "PowerDNS server id (env PDNS_SERVER_ID)")
+	token := fs.String("token", os.Getenv("PDNS_API_TOKEN"), "PowerDNS API token (env PDNS_API_TOKEN)")
+	debug := fs.String("debug", "", "dump API traffic to stdout or stderr")
+	format := fs.String("format", "zone", "output format: zone or json")
+	op := fs.String("op", "append", "operation to preview with diff: append, set or delete")
+	timeout := fs.Duration("timeout", 30*time.Second, "overall timeout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: pdnsdns [flags] list-zones|get|append|set|delete|diff [zone] [record...]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "zone" && *format != "json" {
+		fatalf("unknown format %q", *format)
+	}
+
+	p := &pdnsprovider.Provider{
+		ServerURL: *serverURL,
+		ServerID:  *serverID,
+		APIToken:  *token,
+		Debug:     *debug,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cmd := fs.Arg(0)
+	if cmd == "list-zones" {
+		zs, err := p.ListZones(ctx)
+		if err != nil {
+			fatalf("list-zones: %s", err)
+		}
+		if *format == "json" {
+			writeJSON(os.Stdout, zs)
+			return
+		}
+		for _, z := range zs {
+			fmt.Println(z)
+		}
+		return
+	}
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	zone := fs.Arg(1)
+	records, err := parseRecords(fs.Args()[2:])
+	if err != nil {
+		fatalf("%s", err)
+	}
+
+	var out []libdns.Record
+	switch cmd {
+	case "get":
+		out, err = p.GetRecords(ctx, zone)
+	case "append":
+		out, err = p.AppendRecords(ctx, zone, records)
+	case "set":
+		out, err = p.SetRecords(ctx, zone, records)
+	case "delete":
+		out, err = p.DeleteRecords(ctx, zone, records)
+	case "diff":
+		changes, err := p.PlanChanges(ctx, zone, records, pdnsprovider.Operation(*op))
+		if err != nil {
+			fatalf("diff: %s", err)
+		}
+		if *format == "json" {
+			writeJSON(os.Stdout, changes)
+			return
+		}
+		writeChanges(os.Stdout, changes)
+		return
+	default:
+		fatalf("unknown command %q", cmd)
+	}
+	if err != nil {
+		fatalf("%s: %s", cmd, err)
+	}
+	if *format == "json" {
+		recs := make([]jsonRecord, 0, len(out))
+		for _, r := range out {
+			recs = append(recs, jsonRecord{
+				ID:    r.ID,
+				Name:  r.Name,
+				Type:  r.Type,
+				TTL:   int(r.TTL.Seconds()),
+				Value: r.Value,
+			})
+		}
+		writeJSON(os.Stdout, recs)
+		return
+	}
+	for _, r := range out {
+		fmt.Printf("%s\t%d\tIN\t%s\t%s\n", libdns.AbsoluteName(r.Name, zone), int(r.TTL.Seconds()), r.Type, r.Value)
+	}
+}
+
+// parseRecords parses arguments of the form "name ttl type value".
+func parseRecords(args []string) ([]libdns.Record, error) {
+	var recs []libdns.Record
+	for _, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid record %q, want \"name ttl type value\"", arg)
+		}
+		ttl, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl in record %q: %s", arg, err)
+		}
+		// the value is everything after the type, which may contain spaces
+		value := strings.TrimSpace(arg)
+		for i := 0; i < 3; i++ {
+			value = strings.TrimSpace(value[len(fields[i]):])
+		}
+		recs = append(recs, libdns.Record{
+			Name:  fields[0],
+			TTL:   time.Duration(ttl) * time.Second,
+			Type:  strings.ToUpper(fields[2]),
+			Value: value,
+		})
+	}
+	return recs, nil
+}
+
+func writeChanges(w io.Writer, changes []pdnsprovider.Change) {
+	for _, ch := range changes {
+		rr := ch.RRSet
+		fmt.Fprintf(w, "; %s %s %s\n", ch.Kind, rr.Name, rr.Type)
+		if ch.Existing != nil {
+			for _, r := range ch.Existing.Records {
+				fmt.Fprintf(w, "-%s\t%d\tIN\t%s\t%s\n", rr.Name, ch.Existing.TTL, rr.Type, r.Content)
+			}
+		}
+		for _, r := range rr.Records {
+			fmt.Fprintf(w, "+%s\t%d\tIN\t%s\t%s\n", rr.Name, rr.TTL, rr.Type, r.Content)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatalf("encoding output: %s", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "pdnsdns: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,68 @@
+package pdnsprovider
+
+import (
+	"time"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// annotate carries the comments of existing RRsets in fullZone over to
+// their replacements in rRSets, so that a replace never wipes them, and
+// attaches the configured comment and ownership marker to every RRset that
+// is created or replaced.  Comments set on an RRset in rRSets take the
+// place of the existing ones.
+func (p *Provider) annotate(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) {
+	now := int(time.Now().Unix())
+	var add []zones.Comment
+	if p.Comment != "" {
+		add = append(add, zones.Comment{
+			Content:    p.Comment,
+			Account:    p.CommentAccount,
+			ModifiedAt: now,
+		})
+	}
+	if p.Owner != "" {
+		add = append(add, zones.Comment{
+			Content:    p.Owner,
+			Account:    ownerAccount,
+			ModifiedAt: now,
+		})
+	}
+	existing := make(map[string][]zones.Comment)
+	if fullZone != nil {
+		for _, rr := range fullZone.ResourceRecordSets {
+			existing[key(rr.Name, rr.Type)] = rr.Comments
+		}
+	}
+	for i := range rRSets {
+		rr := &rRSets[i]
+		if rr.ChangeType == zones.ChangeTypeDelete {
+			continue
+		}
+		comments := rr.Comments
+		if comments == nil {
+			comments = existing[key(rr.Name, rr.Type)]
+		}
+		for _, c := range add {
+			comments = mergeComments(comments, c)
+		}
+		rr.Comments = comments
+	}
+}
+
+// mergeComments returns comments with c added.  An earlier comment from the
+// same account, or with the same content when no account is set, is
+// replaced rather than duplicated.
+func mergeComments(comments []zones.Comment, c zones.Comment) []zones.Comment {
+	out := make([]zones.Comment, 0, len(comments)+1)
+	for _, old := range comments {
+		if c.Account != "" && old.Account == c.Account {
+			continue
+		}
+		if c.Account == "" && old.Account == "" && old.Content == c.Content {
+			continue
+		}
+		out = append(out, old)
+	}
+	return append(out, c)
+}
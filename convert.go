@@ -0,0 +1,56 @@
+package pdnsprovider
+
+import (
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// RecordsToRRSets converts libdns records of zone into the RRsets that
+// hold them, the way the Provider does before submitting them: names are
+// made fully qualified and lowercased, priorities are moved into the
+// values with RecordContent, and values repeated for the same name and
+// type are dropped even if their TTLs differ.  Each RRset takes the TTL of
+// its first record and has change type REPLACE.  RRsets
+// are returned in the order their first record appears, and records
+// without a value are left out.
+func RecordsToRRSets(zone string, records []libdns.Record) []zones.ResourceRecordSet {
+	var order []string
+	byKey := make(map[string]*zones.ResourceRecordSet)
+	seen := make(map[string]bool)
+	for _, rec := range convertNamesToAbsolute(zone, normalizeRecords(records)) {
+		if rec.Value == "" {
+			continue
+		}
+		k := key(rec.Name, rec.Type)
+		// PowerDNS rejects RRsets that hold a value twice
+		if seen[k+"|"+rec.Value] {
+			continue
+		}
+		seen[k+"|"+rec.Value] = true
+		rr, ok := byKey[k]
+		if !ok {
+			rr = &zones.ResourceRecordSet{
+				Name:       rec.Name,
+				Type:       rec.Type,
+				TTL:        int(rec.TTL.Seconds()),
+				ChangeType: zones.ChangeTypeReplace,
+			}
+			byKey[k] = rr
+			order = append(order, k)
+		}
+		rr.Records = append(rr.Records, zones.Record{Content: rec.Value})
+	}
+	out := make([]zones.ResourceRecordSet, 0, len(order))
+	for _, k := range order {
+		out = append(out, *byKey[k])
+	}
+	return out
+}
+
+// RRSetToRecords converts an RRset of zone into libdns records, the way
+// GetRecords reports them: named relative to the zone, with the RRset's
+// TTL, the record IDs the Provider accepts and any priority left in the
+// value.  Disabled records are included.
+func RRSetToRecords(zone string, rRSet zones.ResourceRecordSet) []libdns.Record {
+	return appendLDRecords(nil, zone, rRSet)
+}
@@ -0,0 +1,65 @@
+package pdnsprovider
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+func TestRecordContent(t *testing.T) {
+	for _, table := range []struct {
+		rec  libdns.Record
+		want string
+	}{
+		{libdns.Record{Type: "MX", Value: "mail.example.org.", Priority: 10}, "10 mail.example.org."},
+		{libdns.Record{Type: "mx", Value: " mail.example.org. "}, "mail.example.org."},
+		{libdns.Record{Type: "MX", Value: "20 mail.example.org.", Priority: 10}, "20 mail.example.org."},
+		{libdns.Record{Type: "SRV", Value: "5 443 web.example.org.", Priority: 1}, "1 5 443 web.example.org."},
+		{libdns.Record{Type: "SRV", Value: "0 5 443 web.example.org.", Priority: 1}, "0 5 443 web.example.org."},
+		{libdns.Record{Type: "A", Value: "192.0.2.1", Priority: 1}, "192.0.2.1"},
+		{libdns.Record{Type: "MX", Priority: 10}, ""},
+	} {
+		if got := RecordContent(table.rec); got != table.want {
+			t.Errorf("%+v: got %q, expected %q", table.rec, got, table.want)
+		}
+	}
+}
+
+func TestRecordsToRRSets(t *testing.T) {
+	got := RecordsToRRSets("example.org.", []libdns.Record{
+		{Name: "WWW", Type: "a", Value: "192.0.2.1", TTL: time.Minute},
+		{Name: "", Type: "MX", Value: "mail.example.org.", Priority: 10, TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Minute},
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: time.Minute},
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: time.Hour},
+		{Name: "gone", Type: "TXT"},
+	})
+	want := []zones.ResourceRecordSet{
+		{
+			Name:       "www.example.org.",
+			Type:       "A",
+			TTL:        60,
+			ChangeType: zones.ChangeTypeReplace,
+			Records:    []zones.Record{{Content: "192.0.2.1"}, {Content: "192.0.2.2"}},
+		},
+		{
+			Name:       "example.org.",
+			Type:       "MX",
+			TTL:        3600,
+			ChangeType: zones.ChangeTypeReplace,
+			Records:    []zones.Record{{Content: "10 mail.example.org."}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, expected %+v", got, want)
+	}
+
+	// and back
+	recs := RRSetToRecords("example.org.", got[1])
+	if len(recs) != 1 || recs[0].Name != "" || recs[0].Value != "10 mail.example.org." || recs[0].TTL != time.Hour || recs[0].ID == "" {
+		t.Errorf("unexpected records %+v", recs)
+	}
+}
@@ -0,0 +1,87 @@
+package pdnsprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// recentChanges remembers the changes applied within the last DedupWindow,
+// so that identical repeats can be answered without applying them again.
+// Repeats that arrive while the change is still being applied wait for it.
+type recentChanges struct {
+	mu      sync.Mutex
+	changes map[string]*recentChange
+}
+
+type recentChange struct {
+	zone    string
+	wg      sync.WaitGroup
+	expires time.Time
+	result  []libdns.Record
+	err     error
+}
+
+// deduplicate calls apply for op on records, unless the same change was
+// applied to zone within DedupWindow or is being applied, in which case the
+// result of that is returned instead.  Failed changes aren't remembered.
+func (p *Provider) deduplicate(zone string, op Operation, records []libdns.Record, apply func() ([]libdns.Record, error)) ([]libdns.Record, error) {
+	if p.DedupWindow <= 0 {
+		return apply()
+	}
+	k := changeKey(zone, op, records)
+	z := strings.ToLower(strings.TrimSuffix(zone, "."))
+	r := &p.recent
+	now := time.Now()
+	r.mu.Lock()
+	if r.changes == nil {
+		r.changes = make(map[string]*recentChange)
+	}
+	if ch, ok := r.changes[k]; ok && (ch.expires.IsZero() || now.Before(ch.expires)) {
+		r.mu.Unlock()
+		ch.wg.Wait()
+		return append([]libdns.Record(nil), ch.result...), ch.err
+	}
+	for key, ch := range r.changes {
+		// a different change to the zone ends the window of the ones
+		// before it, as repeating them would no longer be a no-op
+		if !ch.expires.IsZero() && (ch.zone == z || !now.Before(ch.expires)) {
+			delete(r.changes, key)
+		}
+	}
+	ch := &recentChange{zone: z}
+	ch.wg.Add(1)
+	r.changes[k] = ch
+	r.mu.Unlock()
+
+	ch.result, ch.err = apply()
+
+	r.mu.Lock()
+	if ch.err != nil {
+		delete(r.changes, k)
+	} else {
+		ch.expires = time.Now().Add(p.DedupWindow)
+	}
+	r.mu.Unlock()
+	ch.wg.Done()
+	return append([]libdns.Record(nil), ch.result...), ch.err
+}
+
+// changeKey returns a digest of op on records in zone that doesn't depend
+// on the order of records.
+func changeKey(zone string, op Operation, records []libdns.Record) string {
+	lines := make([]string, 0, len(records))
+	for _, rec := range convertNamesToAbsolute(zone, records) {
+		lines = append(lines, fmt.Sprintf("%s|%s|%d|%s", rec.Name, rec.Type, rec.TTL, rec.Value))
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s\n%s", strings.ToLower(strings.TrimSuffix(zone, ".")), op, strings.Join(lines, "\n"))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// Record is a libdns record along with PowerDNS specific state.
+type Record struct {
+	libdns.Record
+
+	// Disabled records are kept in the zone but not served.
+	Disabled bool
+
+	// Comments are the comments of the RRset the record belongs to,
+	// such as who created it and why.  Records of the same RRset share
+	// them.
+	Comments []zones.Comment
+}
+
+// GetRecordsWithState lists all the records in the zone along with their
+// disabled state and RRset comments.  The records are always read through the API, since
+// disabled records don't show up in zone transfers.
+func (p *Provider) GetRecordsWithState(ctx context.Context, zone string) ([]Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	var out []Record
+	var recs []libdns.Record
+	err := p.forEachRRSet(ctx, zone, func(rRSet zones.ResourceRecordSet) error {
+		recs = appendLDRecords(recs[:0], zone, rRSet)
+		var comments []zones.Comment
+		if len(rRSet.Comments) > 0 {
+			// the streaming decoder reuses the comment buffer
+			comments = append(comments, rRSet.Comments...)
+		}
+		for i, rec := range recs {
+			if p.OmitSOAAndNS && isApexRecord(rec) {
+				continue
+			}
+			out = append(out, Record{Record: rec, Disabled: rRSet.Records[i].Disabled, Comments: comments})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetRecordsDisabled disables or enables the given records.  Records are
+// matched by name, type and value, after the values are brought into the
+// form they are stored in, as for AppendRecords, and with TXT values
+// quoted.  Records that aren't in the zone are ignored, but it fails if
+// none of them are.  It returns the records whose state was changed.
+func (p *Provider) SetRecordsDisabled(ctx context.Context, zone string, records []libdns.Record, disabled bool) ([]libdns.Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	records = quoteTXTValues(p.qualifyTargets(normalizeRecords(records)))
+	abs := convertNamesToAbsolute(zone, records)
+	fullZone, err := c.partialZone(ctx, zone, abs)
+	if err != nil {
+		return nil, err
+	}
+	inHash := makeLDRecHash(abs)
+	var rRSets []zones.ResourceRecordSet
+	var changed []libdns.Record
+	matched := false
+	for _, t := range fullZone.ResourceRecordSets {
+		recs, ok := inHash[key(t.Name, t.Type)]
+		if !ok {
+			continue
+		}
+		values := make(map[string]bool, len(recs))
+		for _, rec := range recs {
+			values[rec.Value] = true
+		}
+		rr := t
+		rr.ChangeType = zones.ChangeTypeReplace
+		rr.Records = make([]zones.Record, len(t.Records))
+		copy(rr.Records, t.Records)
+		dirty := false
+		for i := range rr.Records {
+			r := &rr.Records[i]
+			if !values[r.Content] {
+				continue
+			}
+			matched = true
+			if r.Disabled != disabled {
+				r.Disabled = disabled
+				dirty = true
+				changed = append(changed, libdns.Record{
+					ID:    recordID(t.Name, t.Type, r.Content),
+					Type:  t.Type,
+					Name:  libdns.RelativeName(t.Name, zone),
+					Value: r.Content,
+					TTL:   time.Duration(t.TTL) * time.Second,
+				})
+			}
+		}
+		if dirty {
+			rRSets = append(rRSets, rr)
+		}
+	}
+	if !matched && len(records) > 0 {
+		return nil, fmt.Errorf("none of the records are in zone %s", zone)
+	}
+	if len(rRSets) == 0 {
+		return nil, nil
+	}
+	if err := p.checkOwnership(fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	p.annotate(fullZone, rRSets)
+	if err := p.updateRRs(ctx, c, zone, fullZone.ID, rRSets); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// keepDisabled carries the disabled state of the values already in fullZone
+// over to the replacement RRsets in rRSets.
+func keepDisabled(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) {
+	if fullZone == nil {
+		return
+	}
+	disabled := make(map[string]bool)
+	for _, t := range fullZone.ResourceRecordSets {
+		for _, r := range t.Records {
+			if r.Disabled {
+				disabled[key(t.Name, t.Type)+":"+r.Content] = true
+			}
+		}
+	}
+	if len(disabled) == 0 {
+		return
+	}
+	for _, rr := range rRSets {
+		for i := range rr.Records {
+			if disabled[key(rr.Name, rr.Type)+":"+rr.Records[i].Content] {
+				rr.Records[i].Disabled = true
+			}
+		}
+	}
+}
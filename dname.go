@@ -0,0 +1,55 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// checkDNAME rejects changes that would leave a DNAME in conflict with the
+// rest of the zone: a name can have only one DNAME and no CNAME next to it,
+// and no data can exist below it, as it redirects the whole subtree.  Names
+// below a DNAME are only seen when fullZone holds them, which partialZone
+// makes sure of for changes that include a DNAME, and it fetches the DNAMEs
+// above every name it fetches and next to every CNAME.
+func checkDNAME(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) error {
+	if fullZone == nil || !hasDNAME(fullZone.ResourceRecordSets) && !hasDNAME(rRSets) {
+		return nil
+	}
+	after := *fullZone
+	after.ResourceRecordSets = append([]zones.ResourceRecordSet(nil), fullZone.ResourceRecordSets...)
+	applyRRSets(&after, rRSets)
+
+	var owners []string
+	for _, rr := range after.ResourceRecordSets {
+		if rr.Type != "DNAME" {
+			continue
+		}
+		if len(rr.Records) > 1 {
+			return fmt.Errorf("%s can only have one DNAME record", rr.Name)
+		}
+		owners = append(owners, strings.ToLower(rr.Name))
+	}
+	for _, rr := range after.ResourceRecordSets {
+		name := strings.ToLower(rr.Name)
+		for _, owner := range owners {
+			switch {
+			case name == owner && rr.Type == "CNAME":
+				return fmt.Errorf("%s can't have both a CNAME and a DNAME", rr.Name)
+			case strings.HasSuffix(name, "."+owner):
+				return fmt.Errorf("%s %s is below the DNAME at %s", rr.Name, rr.Type, owner)
+			}
+		}
+	}
+	return nil
+}
+
+func hasDNAME(rRSets []zones.ResourceRecordSet) bool {
+	for _, rr := range rRSets {
+		if rr.Type == "DNAME" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package pdnsprovider
+
+import (
+	"strings"
+)
+
+// Endpoint is the server and key that the zones below a suffix in
+// Provider.Endpoints are managed through.  Fields left empty are taken from
+// the Provider.
+type Endpoint struct {
+	ServerURL string `json:"server_url,omitempty"`
+	ServerID  string `json:"server_id,omitempty"`
+	APIToken  string `json:"api_token,omitempty"`
+}
+
+// endpointClient is a client built for an entry of Provider.Endpoints,
+// along with the settings it was built from and its circuit breaker.
+type endpointClient struct {
+	c   *client
+	b   *circuitBreaker
+	ep  Endpoint
+	cfg clientConfig
+}
+
+// endpoint returns the entry of Endpoints with the longest suffix that
+// name is equal to or below, and its normalized suffix.
+func (p *Provider) endpoint(name string) (string, Endpoint, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	var (
+		best  string
+		found Endpoint
+		ok    bool
+	)
+	for suffix, ep := range p.Endpoints {
+		s := strings.ToLower(strings.Trim(suffix, "."))
+		if s != "" && name != s && !strings.HasSuffix(name, "."+s) {
+			continue
+		}
+		if !ok || len(s) > len(best) {
+			best, found, ok = s, ep, true
+		}
+	}
+	return best, found, ok
+}
+
+// clientFor returns the client for the zone from Endpoints, or the
+// Provider's client if no entry covers it.  It fails with a *PolicyError if
+// the zone isn't one of AllowedZones.
+func (p *Provider) clientFor(zone string) (*client, error) {
+	if err := p.checkZone(zone); err != nil {
+		return nil, err
+	}
+	return p.clientForName(zone)
+}
+
+// clientForName returns the client for the zone a name is in, like
+// clientFor, for names whose zone is yet to be found.
+func (p *Provider) clientForName(name string) (*client, error) {
+	suffix, ep, ok := p.endpoint(name)
+	if !ok {
+		return p.client()
+	}
+	if ep.ServerURL == "" {
+		ep.ServerURL = p.ServerURL
+	}
+	if ep.ServerID == "" {
+		ep.ServerID = p.ServerID
+	}
+	if ep.ServerID == "" {
+		ep.ServerID = "localhost"
+	}
+
+	p.mu.RLock()
+	e, cfg := p.endpointClients[suffix], p.clientConfig()
+	if e != nil && e.ep == ep && e.cfg == cfg {
+		p.mu.RUnlock()
+		return e.c, nil
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e = p.endpointClients[suffix]; e != nil && e.ep == ep && e.cfg == cfg {
+		return e.c, nil
+	}
+	// an endpoint with its own key doesn't use the TokenSource
+	tokenSource := p.TokenSource
+	apiToken := ep.APIToken
+	if apiToken != "" {
+		tokenSource = nil
+	} else {
+		apiToken = p.APIToken
+	}
+	c, b, err := p.buildClient(ep.ServerURL, ep.ServerID, apiToken, tokenSource)
+	if err != nil {
+		return nil, err
+	}
+	if p.endpointClients == nil {
+		p.endpointClients = make(map[string]*endpointClient)
+	}
+	p.endpointClients[suffix] = &endpointClient{c: c, b: b, ep: ep, cfg: cfg}
+	return c, nil
+}
+
+// EndpointCircuitStats returns the state of the circuit breaker of the
+// entry of Endpoints for suffix, which fails independently of the
+// Provider's own.  The zero value is returned when BreakerThreshold isn't
+// set or the endpoint hasn't been used yet.
+func (p *Provider) EndpointCircuitStats(suffix string) CircuitStats {
+	suffix = strings.ToLower(strings.Trim(suffix, "."))
+	p.mu.RLock()
+	e := p.endpointClients[suffix]
+	p.mu.RUnlock()
+	if e == nil || e.b == nil {
+		return CircuitStats{}
+	}
+	return e.b.stats()
+}
@@ -17,8 +17,8 @@ func main() {
 
 	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
 		{
-			Name: "_acme_whatever",
-			Type: "TXT",
+			Name:  "_acme_whatever",
+			Type:  "TXT",
 			Value: "123456",
 		},
 	})
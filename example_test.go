@@ -0,0 +1,105 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// This is the DNS-01 flow an ACME client such as certmagic runs through
+// the libdns interfaces: publish the challenge, check that the server has
+// it, and remove it once the certificate was issued.
+func ExampleProvider_AppendRecords() {
+	server := startFakeServer(testZone())
+	defer server.Close()
+
+	p := &Provider{
+		ServerURL: server.URL,
+		APIToken:  "secret",
+	}
+	ctx := context.Background()
+	challenge := libdns.Record{
+		Name:  "_acme-challenge.www",
+		Type:  "TXT",
+		Value: "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0",
+		TTL:   time.Minute,
+	}
+
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{challenge})
+	if err != nil {
+		fmt.Println("error presenting the challenge:", err)
+		return
+	}
+	for _, rec := range added {
+		fmt.Println("added", rec.Name, rec.Type, rec.Value)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		fmt.Println("error reading the zone:", err)
+		return
+	}
+	for _, rec := range recs {
+		if rec.Name == challenge.Name && rec.Type == "TXT" {
+			fmt.Println("served", rec.Name, rec.Type, rec.Value)
+		}
+	}
+
+	deleted, err := p.DeleteRecords(ctx, "example.org.", added)
+	if err != nil {
+		fmt.Println("error cleaning up the challenge:", err)
+		return
+	}
+	fmt.Println("deleted", len(deleted), "record")
+	// Output:
+	// added _acme-challenge.www TXT LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0
+	// served _acme-challenge.www TXT LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0
+	// deleted 1 record
+}
+
+// PresentChallenge and CleanupChallenge do the same for callers that hold
+// the name being validated and the key authorization digest, and keep
+// challenges other processes published for the same name intact.
+func ExampleProvider_PresentChallenge() {
+	server := startFakeServer(testZone())
+	defer server.Close()
+
+	p := &Provider{
+		ServerURL: server.URL,
+		APIToken:  "secret",
+	}
+	ctx := context.Background()
+	const digest = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+
+	if err := p.PresentChallenge(ctx, "example.org.", "www.example.org.", digest); err != nil {
+		fmt.Println("error presenting the challenge:", err)
+		return
+	}
+	printChallenges(ctx, p)
+
+	if err := p.CleanupChallenge(ctx, "example.org.", "www.example.org.", digest); err != nil {
+		fmt.Println("error cleaning up the challenge:", err)
+		return
+	}
+	printChallenges(ctx, p)
+	// Output:
+	// _acme-challenge "old-token"
+	// _acme-challenge.www "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+	// _acme-challenge "old-token"
+}
+
+// printChallenges prints the challenge TXT records of example.org.
+func printChallenges(ctx context.Context, p *Provider) {
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		fmt.Println("error reading the zone:", err)
+		return
+	}
+	for _, rec := range recs {
+		if rec.Type == "TXT" {
+			fmt.Println(rec.Name, rec.Value)
+		}
+	}
+}
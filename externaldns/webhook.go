@@ -0,0 +1,292 @@
+// Package externaldns implements the Kubernetes external-dns webhook
+// provider protocol on top of the PowerDNS libdns provider.
+//
+// Run the handler as a sidecar of external-dns started with
+// --provider=webhook:
+//
+//	w := &externaldns.Webhook{
+//		Provider: &pdnsprovider.Provider{ServerURL: url, APIToken: token},
+//		Zones:    []string{"example.org."},
+//	}
+//	log.Fatal(http.ListenAndServe("localhost:8888", w))
+package externaldns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	"github.com/nathanejohnson/pdnsprovider"
+)
+
+// mediaType is the content type negotiated with external-dns.
+const mediaType = "application/external.dns.webhook+json;version=1"
+
+// Endpoint is the external-dns representation of an RRset.
+type Endpoint struct {
+	DNSName          string             `json:"dnsName"`
+	Targets          []string           `json:"targets"`
+	RecordType       string             `json:"recordType"`
+	SetIdentifier    string             `json:"setIdentifier,omitempty"`
+	RecordTTL        int64              `json:"recordTTL,omitempty"`
+	Labels           map[string]string  `json:"labels,omitempty"`
+	ProviderSpecific []ProviderProperty `json:"providerSpecific,omitempty"`
+}
+
+// ProviderProperty is a provider specific endpoint setting.
+type ProviderProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Changes is the set of endpoint changes external-dns asks to apply.
+type Changes struct {
+	Create    []*Endpoint `json:"Create"`
+	UpdateOld []*Endpoint `json:"UpdateOld"`
+	UpdateNew []*Endpoint `json:"UpdateNew"`
+	Delete    []*Endpoint `json:"Delete"`
+}
+
+// DomainFilter tells external-dns which domains the webhook manages.
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Webhook serves the external-dns webhook API.
+type Webhook struct {
+	// Provider is used for all record operations.
+	Provider *pdnsprovider.Provider
+
+	// Zones lists the zones to manage.  If empty, every zone on the
+	// server is managed.
+	Zones []string
+
+	// DefaultTTL is used for endpoints that don't specify a TTL.
+	DefaultTTL time.Duration
+}
+
+// ServeHTTP implements http.Handler.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		zs, err := w.zones(ctx)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		filter := DomainFilter{}
+		for _, z := range zs {
+			filter.Include = append(filter.Include, strings.TrimSuffix(z, "."))
+		}
+		writeJSON(rw, filter)
+	case r.URL.Path == "/healthz":
+		rw.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		eps, err := w.Records(ctx)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(rw, eps)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		var changes Changes
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := w.ApplyChanges(ctx, &changes); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		var eps []*Endpoint
+		if err := json.NewDecoder(r.Body).Decode(&eps); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(rw, eps)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// Records returns the endpoints of all managed zones.
+func (w *Webhook) Records(ctx context.Context) ([]*Endpoint, error) {
+	zs, err := w.zones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var eps []*Endpoint
+	for _, zone := range zs {
+		recs, err := w.Provider.GetRecords(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]*Endpoint)
+		var keys []string
+		for _, rec := range recs {
+			if rec.Type == "SOA" {
+				continue
+			}
+			name := strings.TrimSuffix(libdns.AbsoluteName(rec.Name, zone), ".")
+			k := name + ":" + rec.Type
+			ep, ok := byKey[k]
+			if !ok {
+				ep = &Endpoint{
+					DNSName:    name,
+					RecordType: rec.Type,
+					RecordTTL:  int64(rec.TTL.Seconds()),
+				}
+				byKey[k] = ep
+				keys = append(keys, k)
+			}
+			ep.Targets = append(ep.Targets, fromContent(rec.Type, rec.Value))
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			eps = append(eps, byKey[k])
+		}
+	}
+	return eps, nil
+}
+
+// ApplyChanges applies the changes external-dns requested.  Deleted
+// endpoints, and the old endpoints of updates that don't replace them with
+// the same name and type, are removed first, then created and updated
+// endpoints replace their RRsets.  Changes are applied one zone at a time
+// and nothing is rolled back, so an error can leave the zones applied
+// before it changed.
+func (w *Webhook) ApplyChanges(ctx context.Context, changes *Changes) error {
+	zs, err := w.zones(ctx)
+	if err != nil {
+		return err
+	}
+	deletes := make(map[string][]libdns.Record)
+	sets := make(map[string][]libdns.Record)
+	for _, ep := range changes.Delete {
+		zone, recs := w.toRecords(zs, ep)
+		if zone != "" {
+			deletes[zone] = append(deletes[zone], recs...)
+		}
+	}
+	replaced := make(map[string]bool)
+	for _, ep := range changes.UpdateNew {
+		replaced[endpointKey(ep)] = true
+	}
+	for _, ep := range changes.UpdateOld {
+		if replaced[endpointKey(ep)] {
+			continue
+		}
+		zone, recs := w.toRecords(zs, ep)
+		if zone != "" {
+			deletes[zone] = append(deletes[zone], recs...)
+		}
+	}
+	for _, ep := range append(changes.Create, changes.UpdateNew...) {
+		zone, recs := w.toRecords(zs, ep)
+		if zone != "" {
+			sets[zone] = append(sets[zone], recs...)
+		}
+	}
+	for zone, recs := range deletes {
+		if _, err := w.Provider.DeleteRecords(ctx, zone, recs); err != nil {
+			return err
+		}
+	}
+	for zone, recs := range sets {
+		if _, err := w.Provider.SetRecords(ctx, zone, recs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpointKey identifies the RRset ep maps to.
+func endpointKey(ep *Endpoint) string {
+	return strings.ToLower(strings.TrimSuffix(ep.DNSName, ".")) + ":" + strings.ToUpper(ep.RecordType)
+}
+
+// toRecords converts ep into records relative to the managed zone it
+// belongs to.  An empty zone is returned for endpoints outside all zones.
+func (w *Webhook) toRecords(zs []string, ep *Endpoint) (string, []libdns.Record) {
+	fqdn := strings.ToLower(strings.TrimSuffix(ep.DNSName, ".")) + "."
+	zone := ""
+	for _, z := range zs {
+		z = strings.ToLower(strings.TrimSuffix(z, ".")) + "."
+		if (fqdn == z || strings.HasSuffix(fqdn, "."+z)) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	if zone == "" {
+		return "", nil
+	}
+	ttl := time.Duration(ep.RecordTTL) * time.Second
+	if ttl == 0 {
+		ttl = w.DefaultTTL
+	}
+	if ttl == 0 {
+		ttl = 300 * time.Second
+	}
+	recs := make([]libdns.Record, 0, len(ep.Targets))
+	for _, t := range ep.Targets {
+		recs = append(recs, libdns.Record{
+			Name:  libdns.RelativeName(fqdn, zone),
+			Type:  ep.RecordType,
+			TTL:   ttl,
+			Value: toContent(ep.RecordType, t),
+		})
+	}
+	return zone, recs
+}
+
+func (w *Webhook) zones(ctx context.Context) ([]string, error) {
+	if len(w.Zones) > 0 {
+		return w.Zones, nil
+	}
+	return w.Provider.ListZones(ctx)
+}
+
+// toContent converts an external-dns target to PowerDNS record content.
+func toContent(rrType, target string) string {
+	switch rrType {
+	case "TXT":
+		if strings.HasPrefix(target, `"`) {
+			return target
+		}
+		target = strings.ReplaceAll(target, `\`, `\\`)
+		return `"` + strings.ReplaceAll(target, `"`, `\"`) + `"`
+	case "CNAME", "NS", "MX", "SRV":
+		if !strings.HasSuffix(target, ".") {
+			return target + "."
+		}
+	}
+	return target
+}
+
+// fromContent converts PowerDNS record content to an external-dns target.
+func fromContent(rrType, content string) string {
+	switch rrType {
+	case "TXT":
+		if len(content) >= 2 && strings.HasPrefix(content, `"`) && strings.HasSuffix(content, `"`) {
+			content = content[1 : len(content)-1]
+			content = strings.ReplaceAll(content, `\"`, `"`)
+			return strings.ReplaceAll(content, `\\`, `\`)
+		}
+	case "CNAME", "NS", "MX", "SRV":
+		return strings.TrimSuffix(content, ".")
+	}
+	return content
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", mediaType)
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,428 @@
+package pdnsprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+const fakeAPIKey = "secret"
+
+// fakeLastCheck is the last_check every zone of the fake server reports.
+const fakeLastCheck = 1600000000
+
+// fakeServer is a minimal in-memory implementation of the parts of the
+// PowerDNS API that the provider talks to.
+type fakeServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	zones   map[string]*zones.Zone
+	patches [][]zones.ResourceRecordSet
+	flushed []string
+
+	// gets records the query string of every zone fetch
+	gets []string
+
+	// dropPatches makes the server accept patches without applying them
+	dropPatches bool
+
+	// rejectPatches, when set, is the error every patch fails with
+	rejectPatches string
+
+	// patchLimit, when set, makes patches fail once that many were
+	// applied
+	patchLimit int
+
+	// readOnly is reported as the api-readonly setting
+	readOnly bool
+
+	// notModified counts conditional zone fetches answered with a 304
+	notModified int
+
+	// metadata holds the metadata of each zone by kind
+	metadata map[string]map[string][]string
+
+	// dnssec, apiRectify and presigned are the zone settings of each
+	// zone, and rectified lists the zones rectified
+	dnssec     map[string]bool
+	apiRectify map[string]bool
+	presigned  map[string]bool
+	rectified  []string
+
+	// editedSerial is reported as the edited serial of each zone
+	editedSerial map[string]uint32
+}
+
+func newFakeServer(t *testing.T, zs ...zones.Zone) *fakeServer {
+	t.Helper()
+	fs := startFakeServer(zs...)
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+// startFakeServer starts a fake server serving zs, which the caller must
+// close.
+func startFakeServer(zs ...zones.Zone) *fakeServer {
+	fs := &fakeServer{
+		zones:        make(map[string]*zones.Zone),
+		metadata:     make(map[string]map[string][]string),
+		dnssec:       make(map[string]bool),
+		apiRectify:   make(map[string]bool),
+		presigned:    make(map[string]bool),
+		editedSerial: make(map[string]uint32),
+	}
+	for i := range zs {
+		z := zs[i]
+		if z.ID == "" {
+			z.ID = z.Name
+		}
+		fs.zones[z.ID] = &z
+	}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serveHTTP))
+	return fs
+}
+
+// provider returns a Provider pointed at the fake server.
+func (fs *fakeServer) provider() *Provider {
+	return &Provider{
+		ServerURL: fs.URL,
+		APIToken:  fakeAPIKey,
+	}
+}
+
+// zone returns a copy of the zone with the given id.
+func (fs *fakeServer) zone(id string) zones.Zone {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	z := *fs.zones[id]
+	z.ResourceRecordSets = append([]zones.ResourceRecordSet(nil), z.ResourceRecordSets...)
+	return z
+}
+
+func (fs *fakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") != fakeAPIKey {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if r.URL.Path == "/api/v1/servers" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, []Server{{
+			ID:         "localhost",
+			DaemonType: "authoritative",
+			Version:    "4.8.0",
+			URL:        "/api/v1/servers/localhost",
+		}})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/servers/localhost")
+	if path == r.URL.Path {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	switch {
+	case path == "/zones" && r.Method == http.MethodGet:
+		name := r.URL.Query().Get("zone")
+		out := []zones.Zone{}
+		for _, z := range fs.zones {
+			if name != "" && !strings.EqualFold(z.Name, name) {
+				continue
+			}
+			short := *z
+			short.ResourceRecordSets = nil
+			out = append(out, short)
+		}
+		writeJSON(w, http.StatusOK, out)
+	case path == "/zones" && r.Method == http.MethodPost:
+		var z zones.Zone
+		if err := json.NewDecoder(r.Body).Decode(&z); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := fs.zones[z.Name]; ok {
+			writeError(w, http.StatusConflict, "Conflict")
+			return
+		}
+		z.ID = z.Name
+		fs.zones[z.ID] = &z
+		writeJSON(w, http.StatusCreated, z)
+	case strings.Contains(path, "/metadata/"):
+		fs.serveMetadata(w, r, path)
+	case strings.HasSuffix(path, "/rectify") && r.Method == http.MethodPut:
+		fs.rectified = append(fs.rectified, strings.TrimSuffix(strings.TrimPrefix(path, "/zones/"), "/rectify"))
+		writeJSON(w, http.StatusOK, map[string]string{"result": "Rectified"})
+	case strings.HasPrefix(path, "/zones/"):
+		z, ok := fs.zones[strings.TrimPrefix(path, "/zones/")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Could not find domain")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("rrsets") == "false" {
+				writeJSON(w, http.StatusOK, map[string]interface{}{
+					"id":            z.ID,
+					"name":          z.Name,
+					"kind":          z.Kind,
+					"masters":       z.Masters,
+					"dnssec":        fs.dnssec[z.ID],
+					"api_rectify":   fs.apiRectify[z.ID],
+					"presigned":     fs.presigned[z.ID],
+					"serial":        z.Serial,
+					"edited_serial": fs.editedSerial[z.ID],
+					"account":       z.Account,
+					"last_check":    fakeLastCheck,
+				})
+				return
+			}
+			fs.gets = append(fs.gets, r.URL.RawQuery)
+			name, rrType := r.URL.Query().Get("rrset_name"), r.URL.Query().Get("rrset_type")
+			if name == "" {
+				etag := fmt.Sprintf(`"%d"`, z.Serial)
+				if r.Header.Get("If-None-Match") == etag {
+					fs.notModified++
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Header().Set("ETag", etag)
+				writeJSON(w, http.StatusOK, z)
+				return
+			}
+			filtered := *z
+			filtered.ResourceRecordSets = nil
+			for _, rr := range z.ResourceRecordSets {
+				if rr.Name == name && (rrType == "" || rr.Type == rrType) {
+					filtered.ResourceRecordSets = append(filtered.ResourceRecordSets, rr)
+				}
+			}
+			writeJSON(w, http.StatusOK, filtered)
+		case http.MethodPatch:
+			var in struct {
+				RRSets []zones.ResourceRecordSet `json:"rrsets"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if fs.rejectPatches != "" {
+				writeError(w, http.StatusUnprocessableEntity, fs.rejectPatches)
+				return
+			}
+			if fs.patchLimit > 0 && len(fs.patches) >= fs.patchLimit {
+				writeError(w, http.StatusRequestEntityTooLarge, "patch limit reached")
+				return
+			}
+			if fs.dropPatches {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if err := patchZone(z, in.RRSets); err != nil {
+				writeError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			fs.patches = append(fs.patches, in.RRSets)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPut:
+			var in struct {
+				Kind       zones.ZoneKind `json:"kind"`
+				Masters    []string       `json:"masters"`
+				APIRectify *bool          `json:"api_rectify"`
+				Presigned  *bool          `json:"presigned"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if in.Kind != 0 {
+				z.Kind = in.Kind
+			}
+			if in.Masters != nil {
+				z.Masters = in.Masters
+			}
+			if in.APIRectify != nil {
+				fs.apiRectify[z.ID] = *in.APIRectify
+			}
+			if in.Presigned != nil {
+				fs.presigned[z.ID] = *in.Presigned
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+	case path == "/config" && r.Method == http.MethodGet:
+		readOnly := "no"
+		if fs.readOnly {
+			readOnly = "yes"
+		}
+		writeJSON(w, http.StatusOK, []map[string]string{
+			{"type": "ConfigSetting", "name": "api-readonly", "value": readOnly},
+			{"type": "ConfigSetting", "name": "default-soa-content", "value": "a.misconfigured.dns.server.invalid hostmaster.@ 0 10800 3600 604800 3600"},
+		})
+	case path == "/cache/flush" && r.Method == http.MethodPut:
+		fs.flushed = append(fs.flushed, r.URL.Query().Get("domain"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{"count": 1, "result": "Flushed cache."})
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// serveMetadata serves /zones/{id}/metadata/{kind}.
+func (fs *fakeServer) serveMetadata(w http.ResponseWriter, r *http.Request, path string) {
+	parts := strings.Split(strings.TrimPrefix(path, "/zones/"), "/metadata/")
+	id, kind := parts[0], parts[1]
+	if _, ok := fs.zones[id]; !ok {
+		writeError(w, http.StatusNotFound, "Could not find domain")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		values := fs.metadata[id][kind]
+		if values == nil {
+			values = []string{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"kind": kind, "metadata": values})
+	case http.MethodPut, http.MethodDelete:
+		// like PowerDNS, refuse the kinds that are set through the zone
+		switch kind {
+		case "NSEC3PARAM", "NSEC3NARROW", "PRESIGNED":
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Modifying metadata kind '%s' is unsupported", kind))
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(fs.metadata[id], kind)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var in struct {
+			Metadata []string `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if fs.metadata[id] == nil {
+			fs.metadata[id] = make(map[string][]string)
+		}
+		fs.metadata[id][kind] = in.Metadata
+		writeJSON(w, http.StatusOK, map[string]interface{}{"kind": kind, "metadata": in.Metadata})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// patchZone applies rRSets to z the way PowerDNS does, rejecting the whole
+// patch if any RRset is invalid.
+func patchZone(z *zones.Zone, rRSets []zones.ResourceRecordSet) error {
+	for _, rr := range rRSets {
+		if !strings.HasSuffix(rr.Name, z.Name) {
+			return fmt.Errorf("RRset %s IN %s: Name is out of zone", rr.Name, rr.Type)
+		}
+		seen := make(map[string]bool)
+		for _, rec := range rr.Records {
+			if seen[rec.Content] {
+				return fmt.Errorf("Duplicate record in RRset %s IN %s with content \"%s\"", rr.Name, rr.Type, rec.Content)
+			}
+			seen[rec.Content] = true
+		}
+	}
+	for _, rr := range rRSets {
+		idx := -1
+		for i, t := range z.ResourceRecordSets {
+			if t.Name == rr.Name && t.Type == rr.Type {
+				idx = i
+			}
+		}
+		switch rr.ChangeType {
+		case zones.ChangeTypeDelete:
+			if idx >= 0 {
+				z.ResourceRecordSets = append(z.ResourceRecordSets[:idx], z.ResourceRecordSets[idx+1:]...)
+			}
+		case zones.ChangeTypeReplace:
+			set := rr
+			set.ChangeType = 0
+			if set.Comments == nil && idx >= 0 {
+				set.Comments = z.ResourceRecordSets[idx].Comments
+			}
+			switch {
+			case len(set.Records) == 0:
+				if idx >= 0 {
+					z.ResourceRecordSets = append(z.ResourceRecordSets[:idx], z.ResourceRecordSets[idx+1:]...)
+				}
+			case idx >= 0:
+				z.ResourceRecordSets[idx] = set
+			default:
+				z.ResourceRecordSets = append(z.ResourceRecordSets, set)
+			}
+		default:
+			return fmt.Errorf("changetype not understood")
+		}
+	}
+	z.Serial++
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// testZone returns a zone with a realistic mix of record types.
+func testZone() zones.Zone {
+	return zones.Zone{
+		ID:     "example.org.",
+		Name:   "example.org.",
+		Type:   zones.ZoneTypeZone,
+		Kind:   zones.ZoneKindNative,
+		Serial: 2021010101,
+		ResourceRecordSets: []zones.ResourceRecordSet{
+			{
+				Name: "example.org.",
+				Type: "SOA",
+				TTL:  3600,
+				Records: []zones.Record{
+					{Content: "ns1.example.org. hostmaster.example.org. 2021010101 10800 3600 604800 3600"},
+				},
+			},
+			{
+				Name:    "example.org.",
+				Type:    "NS",
+				TTL:     3600,
+				Records: []zones.Record{{Content: "ns1.example.org."}, {Content: "ns2.example.org."}},
+			},
+			{
+				Name:    "example.org.",
+				Type:    "MX",
+				TTL:     3600,
+				Records: []zones.Record{{Content: "10 mail.example.org."}},
+			},
+			{
+				Name:    "www.example.org.",
+				Type:    "A",
+				TTL:     300,
+				Records: []zones.Record{{Content: "192.0.2.1"}, {Content: "192.0.2.2"}},
+				Comments: []zones.Comment{
+					{Content: "web servers", Account: "ops", ModifiedAt: 1600000000},
+				},
+			},
+			{
+				Name:    "_acme-challenge.example.org.",
+				Type:    "TXT",
+				TTL:     60,
+				Records: []zones.Record{{Content: `"old-token"`}},
+			},
+		},
+	}
+}
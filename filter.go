@@ -0,0 +1,106 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// RecordFilter selects the records GetRecordsFiltered returns.  Empty
+// fields match everything.
+type RecordFilter struct {
+	// Name is a record name relative to the zone, "@" for the apex.
+	// When Name is set the matching RRsets are fetched by name instead
+	// of reading the whole zone.
+	Name string
+
+	// NamePrefix matches relative names that start with it.
+	NamePrefix string
+
+	// Types lists the record types to return.
+	Types []string
+}
+
+// GetRecordsFiltered lists the records in the zone that match filter.
+func (p *Provider) GetRecordsFiltered(ctx context.Context, zone string, filter RecordFilter) ([]libdns.Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	if filter.Name != "" && p.AXFRServer == "" && p.Transport != TransportRFC2136 {
+		c, err := p.clientFor(zone)
+		if err != nil {
+			return nil, err
+		}
+		if c.direct {
+			return c.filteredRecords(ctx, zone, filter, p.OmitSOAAndNS)
+		}
+	}
+	var recs []libdns.Record
+	err := p.ForEachRecord(ctx, zone, func(rec libdns.Record) error {
+		if filter.match(rec) {
+			recs = append(recs, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// filteredRecords fetches the RRsets named by filter with the API's rrset
+// filters, leaving out the SOA and apex NS records if omitApex is set.
+func (c *client) filteredRecords(ctx context.Context, zone string, filter RecordFilter, omitApex bool) ([]libdns.Record, error) {
+	short, err := c.healthyZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	name := convertNamesToAbsolute(zone, []libdns.Record{{Name: filter.Name}})[0].Name
+	types := filter.Types
+	if len(types) == 0 {
+		types = []string{""}
+	}
+	var recs []libdns.Record
+	for _, t := range types {
+		q := url.Values{"rrset_name": {name}}
+		if t != "" {
+			q.Set("rrset_type", t)
+		}
+		var z zones.Zone
+		if err := c.do(ctx, "GET", c.serverPath("zones", short.ID), q, nil, &z); err != nil {
+			return nil, err
+		}
+		for _, rr := range z.ResourceRecordSets {
+			before := len(recs)
+			recs = appendLDRecords(recs, zone, rr)
+			// older servers ignore the filters and send the whole zone
+			for _, rec := range recs[before:] {
+				if !filter.match(rec) || (omitApex && isApexRecord(rec)) {
+					recs = recs[:before]
+					break
+				}
+			}
+		}
+	}
+	return recs, nil
+}
+
+func (f RecordFilter) match(rec libdns.Record) bool {
+	if f.Name != "" && !strings.EqualFold(rec.Name, strings.TrimPrefix(f.Name, "@")) {
+		return false
+	}
+	if f.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(rec.Name), strings.ToLower(f.NamePrefix)) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if strings.EqualFold(rec.Type, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package pdnsprovider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// zoneFlight deduplicates concurrent zone fetches, in the manner of
+// golang.org/x/sync/singleflight.  Callers that arrive while a fetch for the
+// same key is in progress wait for it and share its result, so the returned
+// zone must be treated as read-only.
+type zoneFlight struct {
+	mu    sync.Mutex
+	calls map[string]*zoneCall
+}
+
+type zoneCall struct {
+	done chan struct{}
+	zone *zones.Zone
+	err  error
+
+	// abandoned is set if the fetch failed because the context of the
+	// caller running it ended, which says nothing about the zone.
+	abandoned bool
+}
+
+// do calls fn once for all concurrent callers using key, with the context
+// of the caller that gets to run it.  Waiters give up when their own ctx
+// ends, and fetch again if the one they waited for was abandoned while
+// their ctx is still live.
+func (g *zoneFlight) do(ctx context.Context, key string, fn func(context.Context) (*zones.Zone, error)) (*zones.Zone, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*zoneCall)
+		}
+		if call, ok := g.calls[key]; ok {
+			g.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.abandoned && ctx.Err() == nil {
+				continue
+			}
+			return call.zone, call.err
+		}
+		call := &zoneCall{done: make(chan struct{})}
+		g.calls[key] = call
+		g.mu.Unlock()
+
+		call.zone, call.err = fn(ctx)
+		call.abandoned = call.err != nil && ctx.Err() != nil
+
+		// retries must not find the finished call
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+		return call.zone, call.err
+	}
+}
@@ -0,0 +1,109 @@
+package pdnsprovider
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+func TestZoneFlight(t *testing.T) {
+	var g zoneFlight
+	var calls int32
+	release := make(chan struct{})
+	fn := func(context.Context) (*zones.Zone, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &zones.Zone{Name: "example.org."}, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan *zones.Zone, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			z, err := g.do(context.Background(), "example.org", fn)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			results <- z
+		}()
+	}
+	// let the goroutines pile up behind the first call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	var first *zones.Zone
+	for z := range results {
+		if first == nil {
+			first = z
+		}
+		if z != first {
+			t.Errorf("callers received different results")
+		}
+	}
+
+	// later calls start a new fetch
+	_, _ = g.do(context.Background(), "example.org", fn)
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
+
+func TestZoneFlightAbandoned(t *testing.T) {
+	var g zoneFlight
+	var calls int32
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (*zones.Zone, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &zones.Zone{Name: "example.org."}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "example.org", fn)
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		z, err := g.do(context.Background(), "example.org", fn)
+		if err == nil && z == nil {
+			t.Errorf("no zone and no error")
+		}
+		second <- err
+	}()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelExpired()
+	if _, err := g.do(expired, "example.org", fn); err != context.DeadlineExceeded {
+		t.Errorf("expected the waiter to give up with its own context, got %v", err)
+	}
+	// let the second caller queue up behind the first
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-first; err != context.Canceled {
+		t.Errorf("expected the canceled fetch to fail, got %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("waiter got the error of an abandoned fetch: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("fn called %d times, want 2", calls)
+	}
+}
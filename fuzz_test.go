@@ -0,0 +1,214 @@
+package pdnsprovider
+
+import (
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+var (
+	fuzzNames  = []string{"a.example.org.", "b.example.org.", "c.example.org."}
+	fuzzTypes  = []string{"A", "TXT"}
+	fuzzValues = []string{"1", "2", "3", "4"}
+)
+
+// fuzzRecords decodes each byte of data into a record drawn from small
+// pools, so that inputs collide with each other and with the zone often.
+func fuzzRecords(data []byte) []libdns.Record {
+	recs := make([]libdns.Record, 0, len(data))
+	for _, b := range data {
+		recs = append(recs, libdns.Record{
+			Name:  fuzzNames[int(b)%len(fuzzNames)],
+			Type:  fuzzTypes[int(b)/len(fuzzNames)%len(fuzzTypes)],
+			Value: fuzzValues[int(b)/(len(fuzzNames)*len(fuzzTypes))%len(fuzzValues)],
+		})
+	}
+	return recs
+}
+
+// fuzzZone builds a zone from data the way PowerDNS would store it, with no
+// duplicate values within an RRset.
+func fuzzZone(data []byte) *zones.Zone {
+	z := &zones.Zone{Name: "example.org."}
+	for _, rr := range convertLDHash(makeLDRecHash(fuzzRecords(data))) {
+		rr.ChangeType = 0
+		z.ResourceRecordSets = append(z.ResourceRecordSets, rr)
+	}
+	return z
+}
+
+// zoneValues maps name:type keys to the set of values in the RRset.
+func zoneValues(rRSets []zones.ResourceRecordSet) map[string]map[string]bool {
+	out := make(map[string]map[string]bool)
+	for _, rr := range rRSets {
+		k := key(rr.Name, rr.Type)
+		out[k] = make(map[string]bool)
+		for _, rec := range rr.Records {
+			out[k][rec.Content] = true
+		}
+	}
+	return out
+}
+
+func checkNoDuplicates(t *testing.T, rRSets []zones.ResourceRecordSet) {
+	t.Helper()
+	seenSets := make(map[string]bool)
+	for _, rr := range rRSets {
+		k := key(rr.Name, rr.Type)
+		if seenSets[k] {
+			t.Fatalf("RRset %s submitted twice", k)
+		}
+		seenSets[k] = true
+		seen := make(map[string]bool)
+		for _, rec := range rr.Records {
+			if seen[rec.Content] {
+				t.Fatalf("duplicate value %q in RRset %s", rec.Content, k)
+			}
+			seen[rec.Content] = true
+		}
+	}
+}
+
+func FuzzMergeRRecs(f *testing.F) {
+	f.Add([]byte{0, 1, 2}, []byte{0, 3, 7})
+	f.Add([]byte{}, []byte{5, 5, 5})
+	f.Fuzz(func(t *testing.T, zoneData, inputData []byte) {
+		z := fuzzZone(zoneData)
+		before := zoneValues(z.ResourceRecordSets)
+		input := fuzzRecords(inputData)
+
+		rRSets, err := mergeRRecs(z, input)
+		if err != nil {
+			t.Fatalf("mergeRRecs failed: %s", err)
+		}
+		checkNoDuplicates(t, rRSets)
+		after := zoneValues(rRSets)
+		for _, rr := range rRSets {
+			if rr.ChangeType != zones.ChangeTypeReplace {
+				t.Fatalf("unexpected change type %d for %s", rr.ChangeType, key(rr.Name, rr.Type))
+			}
+		}
+		for _, rec := range input {
+			k := key(rec.Name, rec.Type)
+			if !after[k][rec.Value] {
+				t.Fatalf("appended value %q missing from %s", rec.Value, k)
+			}
+			// nothing that existed may be dropped by an append
+			for v := range before[k] {
+				if !after[k][v] {
+					t.Fatalf("existing value %q dropped from %s", v, k)
+				}
+			}
+		}
+		if len(zoneValues(z.ResourceRecordSets)) != len(before) {
+			t.Fatalf("zone was modified")
+		}
+	})
+}
+
+func FuzzCullRRecs(f *testing.F) {
+	f.Add([]byte{0, 1, 2}, []byte{0, 3, 7})
+	f.Add([]byte{0, 6}, []byte{0, 6})
+	f.Fuzz(func(t *testing.T, zoneData, inputData []byte) {
+		z := fuzzZone(zoneData)
+		before := zoneValues(z.ResourceRecordSets)
+		input := fuzzRecords(inputData)
+		culled := make(map[string]map[string]bool)
+		for _, rec := range input {
+			k := key(rec.Name, rec.Type)
+			if culled[k] == nil {
+				culled[k] = make(map[string]bool)
+			}
+			culled[k][rec.Value] = true
+		}
+
+		rRSets := cullRRecs(z, input)
+		checkNoDuplicates(t, rRSets)
+		for _, rr := range rRSets {
+			k := key(rr.Name, rr.Type)
+			if before[k] == nil {
+				t.Fatalf("change for RRset %s which doesn't exist", k)
+			}
+			for _, rec := range rr.Records {
+				if culled[k][rec.Content] {
+					t.Fatalf("value %q is both kept and deleted in %s", rec.Content, k)
+				}
+				if !before[k][rec.Content] {
+					t.Fatalf("value %q added to %s by a delete", rec.Content, k)
+				}
+			}
+			remaining := 0
+			for v := range before[k] {
+				if !culled[k][v] {
+					remaining++
+				}
+			}
+			if remaining == 0 && rr.ChangeType != zones.ChangeTypeDelete {
+				t.Fatalf("deleting every value of %s yielded change type %d", k, rr.ChangeType)
+			}
+			if remaining != len(rr.Records) {
+				t.Fatalf("%s has %d values, want %d", k, len(rr.Records), remaining)
+			}
+		}
+		if !mapsEqual(zoneValues(z.ResourceRecordSets), before) {
+			t.Fatalf("zone was modified")
+		}
+	})
+}
+
+func FuzzRemoveRecords(f *testing.F) {
+	f.Add([]byte{0, 6, 12, 18}, []byte{6})
+	f.Fuzz(func(t *testing.T, zoneData, inputData []byte) {
+		z := fuzzZone(zoneData)
+		if len(z.ResourceRecordSets) == 0 {
+			return
+		}
+		rr := z.ResourceRecordSets[0]
+		orig := append([]zones.Record(nil), rr.Records...)
+		culls := fuzzRecords(inputData)
+
+		out := removeRecords(rr, culls)
+		drop := make(map[string]bool)
+		for _, c := range culls {
+			drop[c.Value] = true
+		}
+		var want []zones.Record
+		for _, rec := range orig {
+			if !drop[rec.Content] {
+				want = append(want, rec)
+			}
+		}
+		if len(out.Records) != len(want) {
+			t.Fatalf("have %d records, want %d", len(out.Records), len(want))
+		}
+		for i := range want {
+			if out.Records[i] != want[i] {
+				t.Fatalf("record %d: have %#v want %#v", i, out.Records[i], want[i])
+			}
+		}
+		for i := range orig {
+			if rr.Records[i] != orig[i] {
+				t.Fatalf("input RRset was modified")
+			}
+		}
+	})
+}
+
+func mapsEqual(a, b map[string]map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, av := range a {
+		bv := b[k]
+		if len(av) != len(bv) {
+			return false
+		}
+		for v := range av {
+			if !bv[v] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,8 +1,14 @@
 module github.com/nathanejohnson/pdnsprovider
 
-go 1.16
+go 1.18
 
 require (
 	github.com/libdns/libdns v0.2.1
+	github.com/miekg/dns v1.1.50
 	github.com/mittwald/go-powerdns v0.5.2
 )
+
+require (
+	golang.org/x/net v0.0.0-20210726213435-c6fcb2dbf985 // indirect
+	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+)
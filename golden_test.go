@@ -0,0 +1,107 @@
+package pdnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// loadZone reads a zone as the API returns it from testdata/golden.
+func loadZone(t *testing.T, name string) zones.Zone {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "golden", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var z zones.Zone
+	if err := json.Unmarshal(b, &z); err != nil {
+		t.Fatalf("error decoding %s: %s", name, err)
+	}
+	return z
+}
+
+// checkGolden compares lines with the golden file name, or rewrites it
+// with -update.
+func checkGolden(t *testing.T, name string, lines []string) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	have := strings.Join(lines, "\n") + "\n"
+	if *update {
+		if err := os.WriteFile(path, []byte(have), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have != string(want) {
+		t.Errorf("%s doesn't match, run go test -update to see the differences:\nhave:\n%s\nwant:\n%s", name, have, want)
+	}
+}
+
+// changeTypeName returns the name the API knows ct by.
+func changeTypeName(ct zones.RecordSetChangeType) string {
+	b, err := ct.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("changetype(%d)", ct)
+	}
+	return strings.Trim(string(b), `"`)
+}
+
+func TestGoldenGetRecords(t *testing.T) {
+	fs := newFakeServer(t, loadZone(t, "zone.json"))
+	recs, err := fs.provider().GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	lines := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		lines = append(lines, fmt.Sprintf("%s %s %d %d %s %q", rec.ID, rec.Type, int(rec.TTL.Seconds()), rec.Priority, rec.Name, rec.Value))
+	}
+	checkGolden(t, "getrecords.golden", lines)
+}
+
+func TestGoldenSetRecords(t *testing.T) {
+	fs := newFakeServer(t, loadZone(t, "zone.json"))
+	long := strings.Repeat("0123456789", 30)
+	_, err := fs.provider().SetRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "@", Type: "MX", Value: "mail.example.org", Priority: 10, TTL: time.Hour},
+		{Name: "@", Type: "MX", Value: "mx2.example.net.", Priority: 30, TTL: time.Hour},
+		{Name: "WWW", Type: "A", Value: "192.0.2.1", TTL: 5 * time.Minute},
+		{Name: "www", Type: "A", Value: "192.0.2.4", TTL: 5 * time.Minute},
+		{Name: "ftp", Type: "CNAME", Value: "files.example.net", TTL: time.Hour},
+		{Name: "_xmpp._tcp", Type: "SRV", Value: "5 5222 xmpp.example.org", Priority: 10, TTL: time.Hour},
+		{Name: "long", Type: "TXT", Value: long, TTL: time.Minute},
+		{Name: "caa", Type: "CAA", Value: `0 issue "letsencrypt.org"`, TTL: time.Hour},
+		{Name: "*", Type: "A"},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	var lines []string
+	for i, patch := range fs.patches {
+		for _, rr := range patch {
+			lines = append(lines, fmt.Sprintf("patch %d: %s %s %s %d", i, changeTypeName(rr.ChangeType), rr.Name, rr.Type, rr.TTL))
+			for _, r := range rr.Records {
+				lines = append(lines, fmt.Sprintf("  %q disabled=%t", r.Content, r.Disabled))
+			}
+			for _, c := range rr.Comments {
+				lines = append(lines, fmt.Sprintf("  comment %q by %q", c.Content, c.Account))
+			}
+		}
+	}
+	checkGolden(t, "setrecords.golden", lines)
+}
@@ -0,0 +1,67 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ZoneHealthError is returned by record operations on a zone that exists
+// but is in a state that keeps them from working, so that the cause isn't
+// hidden behind a missing record or a rejected change.
+type ZoneHealthError struct {
+	Zone string
+	Kind zones.ZoneKind
+
+	// Problem describes what is wrong with the zone.
+	Problem string
+}
+
+func (e *ZoneHealthError) Error() string {
+	return fmt.Sprintf("zone %s is unhealthy: %s", e.Zone, e.Problem)
+}
+
+// healthyZone looks up the zone like shortZone, failing with a
+// *ZoneHealthError if it can't be served.  Record operations look zones up
+// with it, while zone level operations that may repair a zone don't.
+func (c *client) healthyZone(ctx context.Context, zoneName string) (*zones.Zone, error) {
+	z, err := c.shortZone(ctx, zoneName)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkHealth(z); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// checkHealth inspects the status fields of the zone listing z and returns
+// a *ZoneHealthError if the zone can't be served.  Only secondary zones are
+// checked: one without primaries, or with a serial of 0 because it was
+// never transferred, has no records to read or change.  Listings that
+// didn't come straight from the API may lack the fields and pass.
+func (c *client) checkHealth(z *zones.Zone) error {
+	if !c.direct {
+		return nil
+	}
+	if !isSecondary(z.Kind) {
+		return nil
+	}
+	problem := ""
+	switch {
+	case len(z.Masters) == 0:
+		problem = "secondary zone has no primaries to transfer it from"
+	case z.Serial == 0:
+		problem = fmt.Sprintf("secondary zone was never transferred from %s", strings.Join(z.Masters, ", "))
+	default:
+		return nil
+	}
+	return &ZoneHealthError{Zone: z.Name, Kind: z.Kind, Problem: problem}
+}
+
+// isSecondary reports whether zones of kind are transferred from primaries.
+func isSecondary(kind zones.ZoneKind) bool {
+	return kind == zones.ZoneKindSlave
+}
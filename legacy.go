@@ -0,0 +1,225 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// legacyZones implements ZoneClient for the PowerDNS 3.x API, which lists
+// zone contents as individual records instead of RRsets and leaves the
+// trailing dot off names.
+type legacyZones struct {
+	c *client
+}
+
+type legacyZone struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Kind     string          `json:"kind,omitempty"`
+	Serial   int             `json:"serial,omitempty"`
+	Records  []legacyRecord  `json:"records,omitempty"`
+	Comments []legacyComment `json:"comments,omitempty"`
+}
+
+type legacyRecord struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	TTL      int    `json:"ttl"`
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+	Priority int    `json:"priority"`
+	SetPTR   bool   `json:"set-ptr,omitempty"`
+}
+
+type legacyComment struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	ModifiedAt int    `json:"modified_at"`
+	Account    string `json:"account"`
+	Content    string `json:"content"`
+}
+
+type legacyRRSet struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	ChangeType string          `json:"changetype"`
+	Records    []legacyRecord  `json:"records"`
+	Comments   []legacyComment `json:"comments,omitempty"`
+}
+
+func (l *legacyZones) ListZones(ctx context.Context, serverID string) ([]zones.Zone, error) {
+	var lzs []legacyZone
+	err := l.c.do(ctx, "GET", l.c.serverPath("zones"), nil, nil, &lzs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]zones.Zone, 0, len(lzs))
+	for _, lz := range lzs {
+		kind, err := legacyKind(lz)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, zones.Zone{
+			ID:     lz.ID,
+			Name:   dotted(lz.Name),
+			Type:   zones.ZoneTypeZone,
+			Kind:   kind,
+			Serial: lz.Serial,
+		})
+	}
+	return out, nil
+}
+
+// ListZone returns the zone with the given name.  3.x servers can't filter
+// the zone list, so it is filtered here.
+func (l *legacyZones) ListZone(ctx context.Context, serverID string, zoneName string) ([]zones.Zone, error) {
+	all, err := l.ListZones(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	var out []zones.Zone
+	for _, z := range all {
+		if strings.EqualFold(z.Name, dotted(zoneName)) {
+			out = append(out, z)
+		}
+	}
+	return out, nil
+}
+
+func (l *legacyZones) GetZone(ctx context.Context, serverID, zoneID string) (*zones.Zone, error) {
+	var lz legacyZone
+	err := l.c.do(ctx, "GET", l.c.serverPath("zones", zoneID), nil, nil, &lz)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := legacyKind(lz)
+	if err != nil {
+		return nil, err
+	}
+	z := &zones.Zone{
+		ID:     lz.ID,
+		Name:   dotted(lz.Name),
+		Type:   zones.ZoneTypeZone,
+		Kind:   kind,
+		Serial: lz.Serial,
+	}
+	idx := make(map[string]int)
+	for _, r := range lz.Records {
+		name := dotted(r.Name)
+		k := key(name, r.Type)
+		i, ok := idx[k]
+		if !ok {
+			i = len(z.ResourceRecordSets)
+			idx[k] = i
+			z.ResourceRecordSets = append(z.ResourceRecordSets, zones.ResourceRecordSet{
+				Name: name,
+				Type: r.Type,
+				TTL:  r.TTL,
+			})
+		}
+		content := r.Content
+		if hasPriority(r.Type) {
+			content = strconv.Itoa(r.Priority) + " " + content
+		}
+		rr := &z.ResourceRecordSets[i]
+		rr.Records = append(rr.Records, zones.Record{Content: content, Disabled: r.Disabled, SetPTR: r.SetPTR})
+	}
+	for _, c := range lz.Comments {
+		if i, ok := idx[key(dotted(c.Name), c.Type)]; ok {
+			rr := &z.ResourceRecordSets[i]
+			rr.Comments = append(rr.Comments, zones.Comment{Content: c.Content, Account: c.Account, ModifiedAt: c.ModifiedAt})
+		}
+	}
+	sort.SliceStable(z.ResourceRecordSets, func(i, j int) bool {
+		return key(z.ResourceRecordSets[i].Name, z.ResourceRecordSets[i].Type) < key(z.ResourceRecordSets[j].Name, z.ResourceRecordSets[j].Type)
+	})
+	return z, nil
+}
+
+func (l *legacyZones) AddRecordSetToZone(ctx context.Context, serverID string, zoneID string, set zones.ResourceRecordSet) error {
+	changeType, err := legacyChangeType(set.ChangeType)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(set.Name, ".")
+	lrr := legacyRRSet{
+		Name:       name,
+		Type:       set.Type,
+		ChangeType: changeType,
+		Records:    []legacyRecord{},
+	}
+	for _, r := range set.Records {
+		lr := legacyRecord{
+			Name:     name,
+			Type:     set.Type,
+			TTL:      set.TTL,
+			Content:  r.Content,
+			Disabled: r.Disabled,
+			SetPTR:   r.SetPTR,
+		}
+		if hasPriority(set.Type) {
+			// 3.x keeps the priority out of the content
+			fields := strings.SplitN(r.Content, " ", 2)
+			if prio, err := strconv.Atoi(fields[0]); err == nil && len(fields) == 2 {
+				lr.Priority = prio
+				lr.Content = fields[1]
+			}
+		}
+		lrr.Records = append(lrr.Records, lr)
+	}
+	for _, c := range set.Comments {
+		lrr.Comments = append(lrr.Comments, legacyComment{
+			Name:       name,
+			Type:       set.Type,
+			ModifiedAt: c.ModifiedAt,
+			Account:    c.Account,
+			Content:    c.Content,
+		})
+	}
+	in := struct {
+		RRSets []legacyRRSet `json:"rrsets"`
+	}{[]legacyRRSet{lrr}}
+	return l.c.do(ctx, "PATCH", l.c.serverPath("zones", zoneID), nil, in, nil)
+}
+
+// legacyKind maps the kind of a 3.x zone, which is one of Native, Master
+// and Slave, to a zones.ZoneKind.  Zones listed without one have the zero
+// kind.
+func legacyKind(lz legacyZone) (zones.ZoneKind, error) {
+	switch strings.ToLower(lz.Kind) {
+	case "":
+		return 0, nil
+	case "native":
+		return zones.ZoneKindNative, nil
+	case "master":
+		return zones.ZoneKindMaster, nil
+	case "slave":
+		return zones.ZoneKindSlave, nil
+	}
+	return 0, fmt.Errorf("zone %s has unknown kind %s", lz.Name, lz.Kind)
+}
+
+// legacyChangeType returns the name 3.x servers know ct by.
+func legacyChangeType(ct zones.RecordSetChangeType) (string, error) {
+	switch ct {
+	case zones.ChangeTypeReplace:
+		return "REPLACE", nil
+	case zones.ChangeTypeDelete:
+		return "DELETE", nil
+	}
+	return "", fmt.Errorf("unknown change type %d", ct)
+}
+
+// hasPriority reports whether 3.x servers store a priority for rrType.
+func hasPriority(rrType string) bool {
+	return rrType == "MX" || rrType == "SRV"
+}
+
+func dotted(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
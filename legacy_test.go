@@ -0,0 +1,105 @@
+package pdnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+func TestProviderLegacyAPI(t *testing.T) {
+	zone := legacyZone{
+		ID:   "example.org.",
+		Name: "example.org",
+		Kind: "Native",
+		Records: []legacyRecord{
+			{Name: "example.org", Type: "MX", TTL: 3600, Content: "mail.example.org", Priority: 10},
+			{Name: "www.example.org", Type: "A", TTL: 300, Content: "192.0.2.1"},
+		},
+	}
+	var patches []legacyRRSet
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/servers/localhost/zones":
+			short := zone
+			short.Records = nil
+			writeJSON(w, http.StatusOK, []legacyZone{short})
+		case r.URL.Path == "/servers/localhost/zones/example.org." && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, zone)
+		case r.URL.Path == "/servers/localhost/zones/example.org." && r.Method == http.MethodPatch:
+			var in struct {
+				RRSets []legacyRRSet `json:"rrsets"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			patches = append(patches, in.RRSets...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusNotFound, "Not Found")
+		}
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: fakeAPIKey, LegacyAPI: true}
+
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	var have []string
+	for _, rec := range recs {
+		have = append(have, fmt.Sprintf("%s %s %s", rec.Name, rec.Type, rec.Value))
+	}
+	sort.Strings(have)
+	want := []string{" MX 10 mail.example.org", "www A 192.0.2.1"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+
+	_, err = p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "@", Type: "MX", Value: "20 backup.example.org", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	wantPatch := []legacyRRSet{{
+		Name:       "example.org",
+		Type:       "MX",
+		ChangeType: "REPLACE",
+		Records: []legacyRecord{
+			{Name: "example.org", Type: "MX", TTL: 3600, Content: "mail.example.org", Priority: 10},
+			{Name: "example.org", Type: "MX", TTL: 3600, Content: "backup.example.org", Priority: 20},
+		},
+	}}
+	if !reflect.DeepEqual(patches, wantPatch) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", patches, wantPatch)
+	}
+}
+
+func TestLegacyKind(t *testing.T) {
+	for kind, want := range map[string]zones.ZoneKind{
+		"":       0,
+		"Native": zones.ZoneKindNative,
+		"Master": zones.ZoneKindMaster,
+		"Slave":  zones.ZoneKindSlave,
+	} {
+		have, err := legacyKind(legacyZone{Name: "example.org", Kind: kind})
+		if err != nil {
+			t.Errorf("kind %q: %s", kind, err)
+		} else if have != want {
+			t.Errorf("kind %q: have %d want %d", kind, have, want)
+		}
+	}
+	if _, err := legacyKind(legacyZone{Name: "example.org", Kind: "Supermaster"}); err == nil {
+		t.Error("unknown kind was accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package pdnsprovider
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+func TestMergeRRecsKeepsExisting(t *testing.T) {
+	existing := zones.ResourceRecordSet{
+		Name: "host.example.org.",
+		Type: "A",
+		TTL:  300,
+		Records: []zones.Record{
+			{Content: "192.0.2.3", Disabled: true},
+			{Content: "192.0.2.1", SetPTR: true},
+			{Content: "192.0.2.2"},
+		},
+		Comments: []zones.Comment{{Content: "keep me", Account: "ops"}},
+	}
+	z := &zones.Zone{Name: "example.org.", ResourceRecordSets: []zones.ResourceRecordSet{existing}}
+	orig := append([]zones.Record(nil), existing.Records...)
+
+	out, err := mergeRRecs(z, []libdns.Record{
+		{Name: "host.example.org.", Type: "A", Value: "192.0.2.1", TTL: 5 * time.Minute},
+		{Name: "host.example.org.", Type: "A", Value: "192.0.2.4", TTL: 5 * time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("mergeRRecs failed: %s", err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("expected one RRset, got %#v", out)
+	}
+	want := append(append([]zones.Record(nil), orig...), zones.Record{Content: "192.0.2.4"})
+	if !reflect.DeepEqual(out[0].Records, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", out[0].Records, want)
+	}
+	if !reflect.DeepEqual(out[0].Comments, existing.Comments) {
+		t.Errorf("comments were not kept: %#v", out[0].Comments)
+	}
+	if !reflect.DeepEqual(z.ResourceRecordSets[0].Records, orig) {
+		t.Errorf("input zone was modified: %#v", z.ResourceRecordSets[0].Records)
+	}
+}
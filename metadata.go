@@ -0,0 +1,93 @@
+package pdnsprovider
+
+import (
+	"context"
+)
+
+// zoneMetadata is the body of the zone metadata endpoints.
+type zoneMetadata struct {
+	Kind     string   `json:"kind"`
+	Metadata []string `json:"metadata"`
+}
+
+// GetZoneMetadata returns the values of the metadata kind of zone, such as
+// "ALSO-NOTIFY".  A kind that isn't set has no values.
+func (p *Provider) GetZoneMetadata(ctx context.Context, zone, kind string) ([]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return c.getMetadata(ctx, zID, kind)
+}
+
+// SetZoneMetadata replaces the values of the metadata kind of zone.  Passing
+// no values removes the kind.
+func (p *Provider) SetZoneMetadata(ctx context.Context, zone, kind string, values []string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.setMetadata(ctx, zID, kind, values)
+}
+
+func (c *client) getMetadata(ctx context.Context, zoneID, kind string) ([]string, error) {
+	var out zoneMetadata
+	err := c.do(ctx, "GET", c.serverPath("zones", zoneID, "metadata", kind), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Metadata, nil
+}
+
+func (c *client) setMetadata(ctx context.Context, zoneID, kind string, values []string) error {
+	path := c.serverPath("zones", zoneID, "metadata", kind)
+	if len(values) == 0 {
+		return c.do(ctx, "DELETE", path, nil, nil, nil)
+	}
+	return c.do(ctx, "PUT", path, nil, zoneMetadata{Kind: kind, Metadata: values}, nil)
+}
+
+// editMetadata adds the values in add to the metadata kind of zone and then
+// drops the values in remove, keeping the order of the remaining values.
+// Values already present aren't added twice.
+func (p *Provider) editMetadata(ctx context.Context, zone, kind string, add, remove []string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	defer p.lockZone(zone)()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	values, err := c.getMetadata(ctx, zID, kind)
+	if err != nil {
+		return err
+	}
+	drop := make(map[string]bool, len(values)+len(remove))
+	for _, v := range remove {
+		drop[v] = true
+	}
+	out := make([]string, 0, len(values)+len(add))
+	for _, v := range append(values, add...) {
+		if !drop[v] {
+			out = append(out, v)
+			drop[v] = true
+		}
+	}
+	return c.setMetadata(ctx, zID, kind, out)
+}
@@ -0,0 +1,121 @@
+package pdnsprovider
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ZoneStats describes the traffic the Provider has seen for one zone, for
+// capacity planning of the API backend.
+type ZoneStats struct {
+	// RRSets and Records are the size of the zone as of its last full
+	// read.
+	RRSets  int
+	Records int
+
+	// Fetches counts the full reads of the zone, such as those of
+	// GetRecords, and FetchedBytes the bytes of zone data they read.
+	// Zones read through ZoneClient, the legacy API or CacheZones add no
+	// bytes.
+	Fetches      int
+	FetchedBytes int64
+
+	// Added and Deleted count the records changes applied to the zone
+	// through the API added and removed.
+	Added   int
+	Deleted int
+}
+
+// ZoneStats returns the stats of every zone the Provider has read or
+// changed, by lowercased zone name with a trailing dot.  They are kept for
+// the life of the Provider.
+func (p *Provider) ZoneStats() map[string]ZoneStats {
+	out := make(map[string]ZoneStats)
+	p.stats.Range(func(k, v interface{}) bool {
+		s := v.(*zoneStats)
+		s.mu.Lock()
+		out[k.(string)] = s.s
+		s.mu.Unlock()
+		return true
+	})
+	return out
+}
+
+type zoneStats struct {
+	mu sync.Mutex
+	s  ZoneStats
+}
+
+// zoneStats returns the stats of zone, creating them if needed.
+func (p *Provider) zoneStats(zone string) *zoneStats {
+	k := strings.ToLower(strings.TrimSuffix(zone, ".") + ".")
+	s, _ := p.stats.LoadOrStore(k, &zoneStats{})
+	return s.(*zoneStats)
+}
+
+// countFetch records a full read of zone.
+func (p *Provider) countFetch(zone string, rRSets, records int, bytes int64) {
+	s := p.zoneStats(zone)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.RRSets = rRSets
+	s.s.Records = records
+	s.s.Fetches++
+	s.s.FetchedBytes += bytes
+}
+
+// countChanges records the records that applying rRSets to fullZone added
+// and removed.
+func (p *Provider) countChanges(zone string, fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) {
+	added, deleted := changedRecords(fullZone, rRSets)
+	s := p.zoneStats(zone)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.Added += added
+	s.s.Deleted += deleted
+}
+
+// changedRecords counts the records that applying rRSets to fullZone adds
+// and removes.
+func changedRecords(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) (added, deleted int) {
+	existing := make(map[string]map[string]bool)
+	for _, rr := range fullZone.ResourceRecordSets {
+		values := make(map[string]bool, len(rr.Records))
+		for _, r := range rr.Records {
+			values[r.Content] = true
+		}
+		existing[key(rr.Name, rr.Type)] = values
+	}
+	for _, rr := range rRSets {
+		old := existing[key(rr.Name, rr.Type)]
+		if rr.ChangeType == zones.ChangeTypeDelete {
+			deleted += len(old)
+			continue
+		}
+		kept := 0
+		for _, r := range rr.Records {
+			if old[r.Content] {
+				kept++
+			} else {
+				added++
+			}
+		}
+		deleted += len(old) - kept
+	}
+	return added, deleted
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,116 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// ZoneResult reports the outcome of a multi-zone operation for one zone.
+type ZoneResult struct {
+	// Zone is the name of the zone the records were applied to.
+	Zone string
+
+	// Records are the records returned by the underlying operation.
+	Records []libdns.Record
+
+	// Err is the error the operation returned for this zone, if any.
+	Err error
+}
+
+// ApplyMultiZone applies op to records that may span several zones.  Record
+// names must be fully qualified; each record is assigned to the closest
+// enclosing zone on the server, and the zones are then updated concurrently.
+// An error is returned without changing anything if any record has no owning
+// zone.  Otherwise the per-zone outcomes are reported in the results.
+func (p *Provider) ApplyMultiZone(ctx context.Context, op Operation, records []libdns.Record) ([]ZoneResult, error) {
+	var order []string
+	byZone := make(map[string][]libdns.Record)
+	owners := make(map[string]string)
+	for _, rec := range records {
+		fqdn := strings.ToLower(strings.TrimSuffix(rec.Name, ".") + ".")
+		zone, ok := owners[fqdn]
+		if !ok {
+			c, err := p.clientForName(fqdn)
+			if err != nil {
+				return nil, err
+			}
+			zone, err = c.findZone(ctx, fqdn)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.checkZone(zone); err != nil {
+				return nil, err
+			}
+			owners[fqdn] = zone
+		}
+		if _, ok := byZone[zone]; !ok {
+			order = append(order, zone)
+		}
+		rec.Name = libdns.RelativeName(fqdn, strings.ToLower(zone))
+		byZone[zone] = append(byZone[zone], rec)
+	}
+
+	results := make([]ZoneResult, len(order))
+	var wg sync.WaitGroup
+	for i, zone := range order {
+		wg.Add(1)
+		go func(i int, zone string) {
+			defer wg.Done()
+			recs, err := p.apply(ctx, zone, op, byZone[zone])
+			results[i] = ZoneResult{Zone: zone, Records: recs, Err: err}
+		}(i, zone)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// defaultMultiZoneWorkers is how many zones GetRecordsMulti fetches at once
+// when ZoneConcurrency is unset.
+const defaultMultiZoneWorkers = 4
+
+// GetRecordsMulti fetches the records of several zones concurrently, with at
+// most ZoneConcurrency fetches in flight.  The result for each zone, or the
+// error fetching it, is reported under the zone name as passed in.
+func (p *Provider) GetRecordsMulti(ctx context.Context, zones []string) map[string]ZoneResult {
+	workers := p.ZoneConcurrency
+	if workers <= 0 {
+		workers = defaultMultiZoneWorkers
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]ZoneResult, len(zones))
+		sem     = make(chan struct{}, workers)
+	)
+	for _, zone := range zones {
+		wg.Add(1)
+		go func(zone string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			recs, err := p.GetRecords(ctx, zone)
+			mu.Lock()
+			results[zone] = ZoneResult{Zone: zone, Records: recs, Err: err}
+			mu.Unlock()
+		}(zone)
+	}
+	wg.Wait()
+	return results
+}
+
+// apply dispatches op to the matching libdns method.
+func (p *Provider) apply(ctx context.Context, zone string, op Operation, records []libdns.Record) ([]libdns.Record, error) {
+	switch op {
+	case OperationAppend:
+		return p.AppendRecords(ctx, zone, records)
+	case OperationSet:
+		return p.SetRecords(ctx, zone, records)
+	case OperationDelete:
+		return p.DeleteRecords(ctx, zone, records)
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
@@ -0,0 +1,62 @@
+package pdnsprovider
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// missingZones remembers the zone names the server didn't have for a
+// while, so that repeated lookups of them don't each cost a request.  A nil
+// *missingZones remembers nothing.
+type missingZones struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newMissingZones(ttl time.Duration) *missingZones {
+	return &missingZones{ttl: ttl, now: time.Now, until: make(map[string]time.Time)}
+}
+
+// has reports whether name was found missing within the last ttl.
+func (m *missingZones) has(name string) bool {
+	if m == nil {
+		return false
+	}
+	k := missingKey(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	until, ok := m.until[k]
+	if ok && !m.now().Before(until) {
+		delete(m.until, k)
+		ok = false
+	}
+	return ok
+}
+
+// add records that the server has no zone called name.
+func (m *missingZones) add(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.until[missingKey(name)] = m.now().Add(m.ttl)
+}
+
+// forget drops name, once a zone by that name has been created.
+func (m *missingZones) forget(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.until, missingKey(name))
+}
+
+func missingKey(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".") + ".")
+}
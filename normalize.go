@@ -0,0 +1,91 @@
+package pdnsprovider
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// normalizeRecords returns records with surrounding whitespace trimmed,
+// names lowercased, types uppercased, priorities moved into the values,
+// long TXT strings split and exact duplicates dropped, since PowerDNS
+// rejects RRsets that contain the same value twice.
+func normalizeRecords(records []libdns.Record) []libdns.Record {
+	out := make([]libdns.Record, 0, len(records))
+	seen := make(map[libdns.Record]bool, len(records))
+	for _, rec := range records {
+		rec.Name = strings.ToLower(strings.TrimSpace(rec.Name))
+		rec.Type = strings.ToUpper(strings.TrimSpace(rec.Type))
+		rec.Value = RecordContent(rec)
+		rec.Priority = 0
+		if hasTXTContent(rec.Type) {
+			rec.Value = chunkTXT(rec.Value)
+		}
+		if seen[rec] {
+			continue
+		}
+		seen[rec] = true
+		out = append(out, rec)
+	}
+	return out
+}
+
+// RecordContent returns the value of rec the way PowerDNS stores it.  The
+// API keeps the priority of MX and SRV records at the start of the value,
+// so a Priority set on the record is put there unless the value already
+// starts with one.
+func RecordContent(rec libdns.Record) string {
+	value := strings.TrimSpace(rec.Value)
+	if rec.Priority == 0 || value == "" {
+		return value
+	}
+	fields := len(strings.Fields(value))
+	switch strings.ToUpper(strings.TrimSpace(rec.Type)) {
+	case "MX":
+		if fields == 1 {
+			return strconv.Itoa(rec.Priority) + " " + value
+		}
+	case "SRV":
+		if fields == 3 {
+			return strconv.Itoa(rec.Priority) + " " + value
+		}
+	}
+	return value
+}
+
+// qualifyTargets adds the trailing dot PowerDNS requires to the target
+// names in the values of CNAME, DNAME, NS, PTR, MX and SRV records, which
+// callers usually leave off.  Values that are read back keep the dot, and
+// writing them again changes nothing.  The legacy API stores names without
+// it.
+func (p *Provider) qualifyTargets(records []libdns.Record) []libdns.Record {
+	if p.LegacyAPI {
+		return records
+	}
+	for i, rec := range records {
+		if rec.Value == "" {
+			continue
+		}
+		switch rec.Type {
+		case "CNAME", "DNAME", "NS", "PTR":
+			records[i].Value = qualify(rec.Value)
+		case "MX", "SRV":
+			// the target is the last field, if the value has them all
+			fields := strings.Fields(rec.Value)
+			if rec.Type == "MX" && len(fields) == 2 || rec.Type == "SRV" && len(fields) == 4 {
+				fields[len(fields)-1] = qualify(fields[len(fields)-1])
+				records[i].Value = strings.Join(fields, " ")
+			}
+		}
+	}
+	return records
+}
+
+// qualify adds a trailing dot to name if it has none.
+func qualify(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
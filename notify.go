@@ -0,0 +1,49 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// alsoNotifyKind is the zone metadata kind listing extra NOTIFY targets.
+const alsoNotifyKind = "ALSO-NOTIFY"
+
+// AlsoNotify returns the addresses that are notified of changes to zone in
+// addition to its NS records, as in a hidden primary setup.
+func (p *Provider) AlsoNotify(ctx context.Context, zone string) ([]string, error) {
+	return p.GetZoneMetadata(ctx, zone, alsoNotifyKind)
+}
+
+// AddAlsoNotify adds addresses to the ALSO-NOTIFY list of zone.  Each
+// address is an IP address, optionally with a port as in "192.0.2.1:5300"
+// or "[2001:db8::1]:5300".
+func (p *Provider) AddAlsoNotify(ctx context.Context, zone string, addrs ...string) error {
+	for _, addr := range addrs {
+		if err := validateAddr(addr); err != nil {
+			return err
+		}
+	}
+	return p.editMetadata(ctx, zone, alsoNotifyKind, addrs, nil)
+}
+
+// RemoveAlsoNotify removes addresses from the ALSO-NOTIFY list of zone.
+func (p *Provider) RemoveAlsoNotify(ctx context.Context, zone string, addrs ...string) error {
+	return p.editMetadata(ctx, zone, alsoNotifyKind, nil, addrs)
+}
+
+// validateAddr checks that addr is an IP address, optionally with a port.
+func validateAddr(addr string) error {
+	host := addr
+	if net.ParseIP(addr) == nil {
+		h, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %s", addr, err)
+		}
+		host = h
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("invalid address %q: not an IP address", addr)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ownerAccount is the comment account ownership markers are stored under.
+const ownerAccount = "libdns-owner"
+
+// checkOwnership returns an error if any of rRSets would change an existing
+// RRset that isn't owned by p.Owner.
+func (p *Provider) checkOwnership(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) error {
+	if p.Owner == "" || fullZone == nil {
+		return nil
+	}
+	existing := make(map[string]*zones.ResourceRecordSet, len(fullZone.ResourceRecordSets))
+	for i := range fullZone.ResourceRecordSets {
+		rr := &fullZone.ResourceRecordSets[i]
+		existing[key(rr.Name, rr.Type)] = rr
+	}
+	for _, rr := range rRSets {
+		cur, ok := existing[key(rr.Name, rr.Type)]
+		if !ok || len(cur.Records) == 0 {
+			continue
+		}
+		if owner := rrsetOwner(*cur); owner != p.Owner {
+			if owner == "" {
+				owner = "nobody"
+			}
+			return fmt.Errorf("refusing to modify %s %s: owned by %s, not %s", strings.TrimSuffix(rr.Name, "."), rr.Type, owner, p.Owner)
+		}
+	}
+	return nil
+}
+
+// rrsetOwner returns the owner recorded on rr, or "" if it has none.
+func rrsetOwner(rr zones.ResourceRecordSet) string {
+	for _, c := range rr.Comments {
+		if c.Account == ownerAccount {
+			return c.Content
+		}
+	}
+	return ""
+}
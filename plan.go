@@ -0,0 +1,201 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// Operation names one of the libdns mutations.
+type Operation string
+
+const (
+	// OperationAppend corresponds to AppendRecords.
+	OperationAppend Operation = "append"
+	// OperationSet corresponds to SetRecords.
+	OperationSet Operation = "set"
+	// OperationDelete corresponds to DeleteRecords.
+	OperationDelete Operation = "delete"
+)
+
+// ChangeKind classifies a planned RRset change.
+type ChangeKind string
+
+const (
+	// ChangeAdd creates an RRset that does not exist yet.
+	ChangeAdd ChangeKind = "add"
+	// ChangeReplace replaces the contents of an existing RRset.
+	ChangeReplace ChangeKind = "replace"
+	// ChangeDelete removes an existing RRset.
+	ChangeDelete ChangeKind = "delete"
+)
+
+// Change is a single RRset level change that a mutation would submit.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+
+	// RRSet is the RRset as it would be sent to PowerDNS.
+	RRSet zones.ResourceRecordSet `json:"rrset"`
+
+	// Existing is the RRset currently in the zone, if there is one.
+	Existing *zones.ResourceRecordSet `json:"existing,omitempty"`
+}
+
+// PlanChanges returns the RRset changes that the given operation would
+// perform on the zone, without applying them.
+func (p *Provider) PlanChanges(ctx context.Context, zone string, records []libdns.Record, op Operation) ([]Change, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	records, err := p.prepareRecords(ctx, zone, records, op)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, records))
+	if err != nil {
+		return nil, err
+	}
+	rRSets, err := p.buildChanges(fullZone, zone, records, op)
+	if err != nil {
+		return nil, err
+	}
+	return classifyChanges(fullZone, rRSets), nil
+}
+
+// prepareRecords normalizes the records passed to op and checks them, the
+// same way for planning a change as for applying it.
+func (p *Provider) prepareRecords(ctx context.Context, zone string, records []libdns.Record, op Operation) ([]libdns.Record, error) {
+	switch op {
+	case OperationAppend, OperationSet:
+		records, err := p.resolveTTLs(zone, p.qualifyTargets(p.mirrorSPF(normalizeRecords(records), op)))
+		if err != nil {
+			return nil, err
+		}
+		if err := p.validateRecords(records); err != nil {
+			return nil, err
+		}
+		if err := p.checkPresigned(ctx, zone, records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	case OperationDelete:
+		records, err := p.resolveIDs(ctx, zone, normalizeRecords(records))
+		if err != nil {
+			return nil, err
+		}
+		return p.mirrorSPF(records, op), nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
+
+// buildChanges builds the RRsets that op needs to submit for records, with
+// the provider's settings applied.
+func (p *Provider) buildChanges(fullZone *zones.Zone, zone string, records []libdns.Record, op Operation) ([]zones.ResourceRecordSet, error) {
+	rRSets, err := changeSets(fullZone, zone, records, op)
+	if err != nil {
+		return nil, err
+	}
+	rRSets = dropUnchanged(fullZone, rRSets)
+	if err := p.checkPolicy(zone, rRSets); err != nil {
+		return nil, err
+	}
+	if err := p.checkMaxRecords(zone, fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	if err := checkDNAME(fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	if err := checkSerial(fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	if err := p.checkOwnership(fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	p.annotate(fullZone, rRSets)
+	return rRSets, nil
+}
+
+// dropUnchanged leaves out the RRsets that would be replaced with the TTL
+// and values they already have, so that no-op changes aren't submitted and
+// only names whose data changed are flushed from the cache.
+func dropUnchanged(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) []zones.ResourceRecordSet {
+	if fullZone == nil {
+		return rRSets
+	}
+	existing := make(map[string]*zones.ResourceRecordSet, len(fullZone.ResourceRecordSets))
+	for i := range fullZone.ResourceRecordSets {
+		t := &fullZone.ResourceRecordSets[i]
+		existing[key(t.Name, t.Type)] = t
+	}
+	changed := rRSets[:0]
+	for _, rr := range rRSets {
+		if t, ok := existing[key(rr.Name, rr.Type)]; ok && rr.ChangeType == zones.ChangeTypeReplace && sameValues(*t, rr) {
+			continue
+		}
+		changed = append(changed, rr)
+	}
+	return changed
+}
+
+// changeSets builds the RRsets that op needs to submit for records, in the
+// order their first record appears.  fullZone may be nil for OperationSet,
+// in which case every named RRset is replaced.
+func changeSets(fullZone *zones.Zone, zone string, records []libdns.Record, op Operation) ([]zones.ResourceRecordSet, error) {
+	records = convertNamesToAbsolute(zone, records)
+	var rRSets []zones.ResourceRecordSet
+	switch op {
+	case OperationAppend:
+		var err error
+		rRSets, err = mergeRRecs(fullZone, records)
+		if err != nil {
+			return nil, err
+		}
+	case OperationSet:
+		rRSets = replaceRRecs(fullZone, records)
+	case OperationDelete:
+		rRSets = cullRRecs(fullZone, records)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+	order := make(map[string]int, len(records))
+	for i, rec := range records {
+		if _, ok := order[key(rec.Name, rec.Type)]; !ok {
+			order[key(rec.Name, rec.Type)] = i
+		}
+	}
+	sort.SliceStable(rRSets, func(i, j int) bool {
+		return order[key(rRSets[i].Name, rRSets[i].Type)] < order[key(rRSets[j].Name, rRSets[j].Type)]
+	})
+	return rRSets, nil
+}
+
+func classifyChanges(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) []Change {
+	existing := make(map[string]*zones.ResourceRecordSet, len(fullZone.ResourceRecordSets))
+	for i := range fullZone.ResourceRecordSets {
+		t := &fullZone.ResourceRecordSets[i]
+		existing[key(t.Name, t.Type)] = t
+	}
+	changes := make([]Change, 0, len(rRSets))
+	for _, rr := range rRSets {
+		ch := Change{
+			RRSet:    rr,
+			Existing: existing[key(rr.Name, rr.Type)],
+		}
+		switch {
+		case rr.ChangeType == zones.ChangeTypeDelete:
+			ch.Kind = ChangeDelete
+		case ch.Existing == nil:
+			ch.Kind = ChangeAdd
+		default:
+			ch.Kind = ChangeReplace
+		}
+		changes = append(changes, ch)
+	}
+	return changes
+}
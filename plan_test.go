@@ -0,0 +1,85 @@
+package pdnsprovider
+
+import (
+	"testing"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+func TestPlanChanges(t *testing.T) {
+	fullZone := &zones.Zone{
+		Name: "example.org.",
+		ResourceRecordSets: []zones.ResourceRecordSet{
+			{
+				Name:    "1.example.org.",
+				Type:    "A",
+				TTL:     60,
+				Records: []zones.Record{{Content: "127.0.0.1"}, {Content: "127.0.0.2"}},
+			},
+			{
+				Name:    "2.example.org.",
+				Type:    "A",
+				TTL:     60,
+				Records: []zones.Record{{Content: "127.0.0.3"}},
+			},
+		},
+	}
+
+	for _, table := range []struct {
+		name    string
+		op      Operation
+		records []libdns.Record
+		want    map[string]ChangeKind
+	}{
+		{
+			name: "append to existing and new",
+			op:   OperationAppend,
+			records: []libdns.Record{
+				{Name: "1", Type: "A", Value: "127.0.0.9"},
+				{Name: "3", Type: "A", Value: "127.0.0.9"},
+			},
+			want: map[string]ChangeKind{
+				"1.example.org.:A": ChangeReplace,
+				"3.example.org.:A": ChangeAdd,
+			},
+		},
+		{
+			name: "delete last and partial",
+			op:   OperationDelete,
+			records: []libdns.Record{
+				{Name: "1", Type: "A", Value: "127.0.0.1"},
+				{Name: "2", Type: "A", Value: "127.0.0.3"},
+			},
+			want: map[string]ChangeKind{
+				"1.example.org.:A": ChangeReplace,
+				"2.example.org.:A": ChangeDelete,
+			},
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			rRSets, err := changeSets(fullZone, "example.org.", table.records, table.op)
+			if err != nil {
+				t.Fatalf("changeSets failed: %s", err)
+			}
+			changes := classifyChanges(fullZone, rRSets)
+			have := make(map[string]ChangeKind)
+			for _, ch := range changes {
+				have[key(ch.RRSet.Name, ch.RRSet.Type)] = ch.Kind
+			}
+			if len(have) != len(table.want) {
+				t.Fatalf("assertion failed: have: %#v want %#v", have, table.want)
+			}
+			for k, v := range table.want {
+				if have[k] != v {
+					t.Errorf("assertion failed for %s: have: %s want %s", k, have[k], v)
+				}
+			}
+		})
+	}
+
+	// planning must never modify the fetched zone
+	if len(fullZone.ResourceRecordSets[0].Records) != 2 {
+		t.Errorf("zone data was modified: %#v", fullZone.ResourceRecordSets[0].Records)
+	}
+}
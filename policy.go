@@ -0,0 +1,130 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// PolicyError is returned when the Provider's settings forbid an
+// operation on a zone.
+type PolicyError struct {
+	Zone string
+
+	// Reason explains which setting forbids the operation.
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("operation on zone %s not allowed: %s", e.Zone, e.Reason)
+}
+
+// ReadOnlyError is returned by operations that would change something
+// while Provider.ReadOnly is set.
+type ReadOnlyError struct {
+	// Op describes the refused change.
+	Op string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("refusing to %s: the provider is read-only", e.Op)
+}
+
+// checkZone returns a *PolicyError if zone isn't one of AllowedZones.
+func (p *Provider) checkZone(zone string) error {
+	if !p.zoneAllowed(zone) {
+		return &PolicyError{Zone: zone, Reason: "not one of AllowedZones"}
+	}
+	return nil
+}
+
+// zoneAllowed reports whether zone is one of AllowedZones, or whether any
+// zone is when AllowedZones is empty.
+func (p *Provider) zoneAllowed(zone string) bool {
+	if len(p.AllowedZones) == 0 {
+		return true
+	}
+	zone = strings.TrimSuffix(zone, ".")
+	for _, z := range p.AllowedZones {
+		if strings.EqualFold(strings.TrimSuffix(z, "."), zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy returns an error if the Provider's settings forbid changing
+// rRSets in zone.
+func (p *Provider) checkPolicy(zone string, rRSets []zones.ResourceRecordSet) error {
+	if err := p.checkApex(zone, rRSets); err != nil {
+		return err
+	}
+	return p.checkProtected(zone, rRSets)
+}
+
+// checkApex returns a *PolicyError for rRSets that would remove the SOA
+// record or all the apex NS records of zone, which leaves the zone
+// unservable, unless AllowApexRemoval is set.
+func (p *Provider) checkApex(zone string, rRSets []zones.ResourceRecordSet) error {
+	if p.AllowApexRemoval {
+		return nil
+	}
+	apex := strings.ToLower(strings.TrimSuffix(zone, ".") + ".")
+	for _, rr := range rRSets {
+		if !strings.EqualFold(rr.Name, apex) || (rr.Type != "SOA" && rr.Type != "NS") {
+			continue
+		}
+		if rr.ChangeType == zones.ChangeTypeDelete || len(rr.Records) == 0 {
+			what := "the SOA record"
+			if rr.Type == "NS" {
+				what = "all apex NS records"
+			}
+			return &PolicyError{Zone: zone, Reason: fmt.Sprintf("removing %s needs AllowApexRemoval", what)}
+		}
+	}
+	return nil
+}
+
+// checkProtected returns a *PolicyError for rRSets that touch a record
+// matched by one of the Protected patterns.
+func (p *Provider) checkProtected(zone string, rRSets []zones.ResourceRecordSet) error {
+	apex := strings.ToLower(strings.TrimSuffix(zone, ".") + ".")
+	for _, pattern := range p.Protected {
+		fields := strings.Fields(pattern)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid protected record pattern %q, expected a type and a name", pattern)
+		}
+		typePattern, namePattern := strings.ToUpper(fields[0]), strings.ToLower(fields[1])
+		if _, err := path.Match(namePattern, ""); err != nil {
+			return fmt.Errorf("invalid protected record pattern %q: %s", pattern, err)
+		}
+		for _, rr := range rRSets {
+			name := libdns.RelativeName(strings.ToLower(rr.Name), apex)
+			if name == "" {
+				name = "@"
+			}
+			typeOK, _ := path.Match(typePattern, rr.Type)
+			nameOK, _ := path.Match(namePattern, name)
+			if typeOK && nameOK {
+				return &PolicyError{Zone: zone, Reason: fmt.Sprintf("%s %s is protected by %q", strings.TrimSuffix(rr.Name, "."), rr.Type, pattern)}
+			}
+		}
+	}
+	return nil
+}
+
+// checkMaxRecords returns a *PolicyError if applying rRSets to fullZone
+// would add and remove more than MaxRecords records.
+func (p *Provider) checkMaxRecords(zone string, fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) error {
+	if p.MaxRecords <= 0 || fullZone == nil {
+		return nil
+	}
+	added, deleted := changedRecords(fullZone, rRSets)
+	if added+deleted > p.MaxRecords {
+		return &PolicyError{Zone: zone, Reason: fmt.Sprintf("would add %d and remove %d records, more than MaxRecords (%d)", added, deleted, p.MaxRecords)}
+	}
+	return nil
+}
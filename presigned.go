@@ -0,0 +1,65 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/libdns/libdns"
+)
+
+// Presigned reports whether zone is presigned, that is signed outside of
+// PowerDNS and served with the signatures it was given.
+func (p *Provider) Presigned(ctx context.Context, zone string) (bool, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return false, err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return false, err
+	}
+	settings, err := c.zoneSettings(ctx, zID)
+	if err != nil {
+		return false, err
+	}
+	return settings.Presigned, nil
+}
+
+// SetPresigned marks zone as presigned or not.  Only presigned zones accept
+// RRSIG, NSEC, NSEC3 and DNSKEY records written through this provider.
+// The flag is set on the zone itself, as PowerDNS doesn't allow the
+// PRESIGNED metadata to be changed through the API.
+func (p *Provider) SetPresigned(ctx context.Context, zone string, presigned bool) error {
+	in := struct {
+		Presigned bool `json:"presigned"`
+	}{presigned}
+	return p.updateZone(ctx, zone, in)
+}
+
+// checkPresigned rejects writes of DNSSEC records to zones that PowerDNS
+// signs itself, where they would clash with the generated ones.
+func (p *Provider) checkPresigned(ctx context.Context, zone string, records []libdns.Record) error {
+	if p.Transport == TransportRFC2136 {
+		return nil
+	}
+	var signed *libdns.Record
+	for i, rec := range records {
+		switch rec.Type {
+		case "RRSIG", "NSEC", "NSEC3", "DNSKEY":
+			signed = &records[i]
+		}
+	}
+	if signed == nil {
+		return nil
+	}
+	presigned, err := p.Presigned(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if !presigned {
+		return fmt.Errorf("%s records can only be written to presigned zones, and %s is not", signed.Type, zone)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// propagationInterval is how long WaitForPropagation sleeps between rounds of
+// queries.
+var propagationInterval = 2 * time.Second
+
+// WaitForPropagation queries the zone's authoritative nameservers directly
+// until every one of them serves all of the given records, or until timeout
+// elapses.  A timeout of 0 relies solely on ctx for cancellation.  It is
+// WaitForRecords with the default options.
+func (p *Provider) WaitForPropagation(ctx context.Context, zone string, records []libdns.Record, timeout time.Duration) error {
+	_, err := p.WaitForRecords(ctx, zone, records, WaitOptions{Timeout: timeout})
+	return err
+}
+
+// nameserverAddrs resolves the apex NS records of the zone to host:port
+// addresses that can be queried directly.
+func (c *client) nameserverAddrs(ctx context.Context, zone string) ([]string, error) {
+	apex := strings.TrimSuffix(zone, ".") + "."
+	fullZone, err := c.partialZone(ctx, zone, []libdns.Record{{Name: apex, Type: "NS"}})
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, rr := range fullZone.ResourceRecordSets {
+		if rr.Type != "NS" || !strings.EqualFold(rr.Name, apex) {
+			continue
+		}
+		for _, r := range rr.Records {
+			if !r.Disabled {
+				hosts = append(hosts, r.Content)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no NS records found for zone %s", zone)
+	}
+	var addrs []string
+	for _, host := range hosts {
+		ips, err := net.DefaultResolver.LookupHost(ctx, strings.TrimSuffix(host, "."))
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, "53"))
+		}
+	}
+	return addrs, nil
+}
+
+// queryValues asks server for the name/type and returns the answer data in
+// presentation format.  recurse sets the RD bit, for servers that aren't
+// authoritative.
+func queryValues(ctx context.Context, server, name, rrType string, recurse bool) ([]string, error) {
+	t, ok := dns.StringToType[strings.ToUpper(rrType)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %q", rrType)
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), t)
+	m.RecursionDesired = recurse
+
+	dc := &dns.Client{}
+	in, _, err := dc.ExchangeContext(ctx, m, server)
+	if err == nil && in.Truncated {
+		dc.Net = "tcp"
+		in, _, err = dc.ExchangeContext(ctx, m, server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("query for %s %s to %s failed: %s", name, rrType, server, dns.RcodeToString[in.Rcode])
+	}
+	var values []string
+	for _, rr := range in.Answer {
+		if rr.Header().Rrtype == t {
+			values = append(values, rdata(rr))
+		}
+	}
+	return values, nil
+}
+
+// rdata returns the presentation format of the data portion of rr.
+func rdata(rr dns.RR) string {
+	return strings.TrimSpace(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSuffix(v, "."), strings.TrimSuffix(value, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,148 +3,787 @@ package pdnsprovider
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
 )
 
 // Provider facilitates DNS record manipulation with PowerDNS.
+//
+// A Provider is safe for concurrent use by multiple goroutines once it has
+// been configured.  Mutations of the same zone are serialized within a
+// Provider so that their read-merge-write cycles don't overwrite each other;
+// operations on different zones run in parallel.
 type Provider struct {
-	// ServerURL is the location of the pdns server.
+	// ServerURL is the location of the pdns server, such as
+	// "https://pdns.example.org:8081".  Trailing slashes and the API
+	// path, "/api/v1" by default, may be included.
 	ServerURL string `json:"server_url"`
 
+	// APIPath is the path below ServerURL that the API is served at.  It
+	// defaults to "/api/v1" and only needs to be set when a reverse
+	// proxy exposes the API under a different path.
+	APIPath string `json:"api_path,omitempty"`
+
+	// LegacyAPI talks to the API of PowerDNS 3.x servers, which is
+	// served without the /api/v1 prefix and has a flat record schema.
+	// Only record management is supported in this mode.
+	LegacyAPI bool `json:"legacy_api,omitempty"`
+
 	// ServerID is the id of the server.  localhost will be used
 	// if this is omitted.
-	ServerID  string `json:"server_id,omitempty"`
+	ServerID string `json:"server_id,omitempty"`
 
 	// APIToken is the auth token.
-	APIToken  string `json:"api_token,omitempty"`
+	APIToken string `json:"api_token,omitempty"`
+
+	// TokenSource, when set, is called for the API key before every
+	// request instead of using APIToken, so the key can be rotated
+	// without recreating the Provider.  It should cache the key, and
+	// must be safe for concurrent use.
+	TokenSource func(ctx context.Context) (string, error) `json:"-"`
+
+	// MaxIdleConnsPerHost, IdleConnTimeout and DisableKeepAlives tune
+	// the HTTP connection pool used for the API, see net/http.Transport.
+	// Raising MaxIdleConnsPerHost above the default of 2 keeps busy
+	// clients from opening a new connection for most requests.
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout,omitempty"`
+	DisableKeepAlives   bool          `json:"disable_keep_alives,omitempty"`
+
+	// Resolver, when set, looks up the host name of ServerURL instead
+	// of the system resolver, for split DNS setups where the API's name
+	// is only known to an internal DNS server.
+	Resolver *net.Resolver `json:"-"`
+
+	// DialContext, when set, opens the connections to the API in place
+	// of a net.Dialer, and Resolver is not used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+
+	// HTTPTransport, when set, carries the API requests in place of the
+	// default transport and the settings above.
+	// Responses are asked for gzip compressed and decoded by the client
+	// either way.
+	HTTPTransport http.RoundTripper `json:"-"`
+
+	// Retries, when above zero, retries API requests that failed with a
+	// connection error, a rate limit or a gateway error up to this many
+	// times, with DefaultRetryPolicy.
+	Retries int `json:"retries,omitempty"`
+
+	// RetryPolicy, when set, decides which API requests are retried and
+	// how long to wait in between, in place of Retries.
+	RetryPolicy RetryPolicy `json:"-"`
+
+	// BreakerThreshold, when above zero, turns on a circuit breaker:
+	// after this many API requests in a row have failed, requests fail
+	// right away with a *CircuitOpenError for BreakerCooldown, 30s by
+	// default, before a single request is let through to try the API
+	// again.  A request counts once however often it was retried.  See
+	// CircuitStats.
+	BreakerThreshold int           `json:"breaker_threshold,omitempty"`
+	BreakerCooldown  time.Duration `json:"breaker_cooldown,omitempty"`
 
 	// Debug - can set this to stdout or stderr to dump
 	// debugging information about the API interaction with
-	// powerdns.  This will dump your auth token in plain text
-	// so be careful.
-	Debug     string `json:"debug,omitempty"`
+	// powerdns.  The auth token is redacted from the output.
+	Debug string `json:"debug,omitempty"`
+
+	// FlushCache purges the names whose data changed from the server's
+	// packet cache after every mutation, so that the new data is served
+	// right away instead of after the cache entries expire.  Names that
+	// a mutation leaves as they were aren't flushed.
+	FlushCache bool `json:"flush_cache,omitempty"`
+
+	// Comment, when set, is attached as an RRset comment to every RRset
+	// this provider creates or modifies.  Existing comments are kept, and
+	// a comment previously written with the same CommentAccount is
+	// replaced.
+	Comment string `json:"comment,omitempty"`
+
+	// CommentAccount is the account recorded with Comment.
+	CommentAccount string `json:"comment_account,omitempty"`
+
+	// Owner, when set, turns on ownership tracking: every RRset this
+	// provider creates or modifies is tagged with an RRset comment naming
+	// Owner, and RRsets that exist without that tag are never modified or
+	// deleted.  This keeps automation from clobbering records managed by
+	// hand or by another owner.  Ownership is only enforced with the
+	// "api" transport.
+	Owner string `json:"owner,omitempty"`
+
+	// BatchWindow, when non-zero, queues mutations of a zone for this
+	// long and then submits them together as a single patch.  Callers
+	// block until their batch has been applied.  This saves many API
+	// calls when lots of changes hit one zone at once, as with ACME
+	// challenges for many names.  Batching is only used with the "api"
+	// transport.
+	BatchWindow time.Duration `json:"batch_window,omitempty"`
+
+	// OmitSOAAndNS leaves the SOA and apex NS records out of GetRecords
+	// and ForEachRecord.  Most consumers should never touch them, and
+	// feeding them back into Set or Delete calls is destructive.
+	OmitSOAAndNS bool `json:"omit_soa_and_ns,omitempty"`
+
+	// Rectify rectifies DNSSEC signed zones after every mutation, unless
+	// the server is set to do so itself with the zone's API-RECTIFY
+	// setting.  It costs an extra request per mutation to look up the
+	// zone's settings.
+	Rectify bool `json:"rectify,omitempty"`
+
+	// VerifyWrites re-reads the changed RRsets after every mutation and
+	// returns an error if they don't match what was submitted, which
+	// catches concurrent writers and patches the server silently
+	// ignored.
+	VerifyWrites bool `json:"verify_writes,omitempty"`
+
+	// Timeout bounds each operation whose context has no deadline of its
+	// own, so that a hung connection can't block forever.  It defaults
+	// to one minute; a negative value disables it.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// CacheZones keeps the last copy of every zone read in full, and
+	// reads it again with a conditional request, so unchanged zones cost
+	// a 304 response instead of the whole zone.  It only helps when the
+	// API, or a proxy in front of it, sends ETags, and full zones are
+	// kept in memory.
+	CacheZones bool `json:"cache_zones,omitempty"`
+
+	// ZoneNotFoundTTL, when positive, is how long a zone the server
+	// doesn't have is remembered as missing, so that repeated lookups of
+	// it, such as those for the parent domains of a name, don't each
+	// cost a request.  Zones created through the Provider are forgotten
+	// at once; ones created elsewhere are found once it expires.
+	ZoneNotFoundTTL time.Duration `json:"zone_not_found_ttl,omitempty"`
+
+	// UpdateConcurrency, when above one, submits the RRsets of a change
+	// as separate requests, up to this many at a time, instead of in a
+	// single patch.  This suits servers that reject very large patches,
+	// at the cost of changes no longer being applied atomically.
+	UpdateConcurrency int `json:"update_concurrency,omitempty"`
+
+	// PatchSize, when positive, caps how many RRsets are sent in one
+	// patch: larger changes are split into patches of this many RRsets,
+	// which are applied in order, for servers or proxies that reject
+	// very large requests.  A change split this way is no longer applied
+	// atomically; if a patch fails, the rest aren't sent and a
+	// *PartialUpdateError reports what was applied.
+	PatchSize int `json:"patch_size,omitempty"`
+
+	// ZoneConcurrency bounds how many zones GetRecordsMulti fetches at
+	// once.  It defaults to 4.
+	ZoneConcurrency int `json:"zone_concurrency,omitempty"`
+
+	// View selects the zone variant to manage on servers with views
+	// support.  When set, operations on zone "example.org." are applied to
+	// the variant "example.org..<View>" instead of the default zone.
+	View string `json:"view,omitempty"`
+
+	// Transport selects how record changes are applied: "api" (the
+	// default) uses the HTTP API and "rfc2136" sends dynamic updates to
+	// DNSUpdateServer.  With "rfc2136", records are listed with a zone
+	// transfer from AXFRServer, or DNSUpdateServer if that is unset.
+	Transport string `json:"transport,omitempty"`
+
+	// DNSUpdateServer is the host:port dynamic updates are sent to.
+	// Updates are signed with the TSIG settings below.
+	DNSUpdateServer string `json:"dns_update_server,omitempty"`
+
+	// AXFRServer, when set to a host:port, makes GetRecords and
+	// ForEachRecord list zones with a zone transfer from that server
+	// instead of through the API, which is much lighter for very large
+	// zones.  The server must allow transfers from this host.
+	AXFRServer string `json:"axfr_server,omitempty"`
+
+	// TSIGKeyName, TSIGAlgorithm and TSIGSecret sign DNS messages sent
+	// to the server.  TSIGSecret is base64 encoded and TSIGAlgorithm
+	// defaults to hmac-sha256.
+	TSIGKeyName   string `json:"tsig_key_name,omitempty"`
+	TSIGAlgorithm string `json:"tsig_algorithm,omitempty"`
+	TSIGSecret    string `json:"tsig_secret,omitempty"`
+
+	// Secondaries lists the host:port addresses of the secondary
+	// servers WaitForSecondaries checks.  It defaults to the addresses
+	// of the zone's NS records.
+	Secondaries []string `json:"secondaries,omitempty"`
+
+	// Endpoints maps zone suffixes to the server and API key of the zones
+	// equal to or below them, for zones that live on other servers than
+	// ServerURL or need other keys.  The longest matching suffix wins,
+	// and zones no entry covers use the Provider's own settings.  An
+	// endpoint with an APIToken doesn't use TokenSource.  ListZones and
+	// the other calls that aren't about a zone only use ServerURL.
+	Endpoints map[string]Endpoint `json:"endpoints,omitempty"`
+
+	// MirrorSPF applies every change to a record of the obsolete SPF
+	// type to a TXT record with the same name and value as well, which
+	// is where resolvers look for SPF policies.  Without it, changes to
+	// SPF records are applied as given.  Writing SPF records draws a
+	// warning either way.
+	MirrorSPF bool `json:"mirror_spf,omitempty"`
+
+	// Warnf is called with warnings about operations that succeed but
+	// are likely mistakes, such as writing SPF records.  Warnings are
+	// written to the standard logger when it is unset.
+	Warnf func(format string, args ...interface{}) `json:"-"`
+
+	// AllowApexRemoval lets changes remove the SOA record or all the
+	// apex NS records of a zone, which fail with a *PolicyError by
+	// default since they leave the zone unservable.  Updates sent with
+	// RFC 2136 don't read the zone, so deleting any of its apex NS
+	// records needs it there.
+	AllowApexRemoval bool `json:"allow_apex_removal,omitempty"`
+
+	// DedupWindow, when positive, is how long AppendRecords, SetRecords
+	// and DeleteRecords remember the changes they applied: a call that
+	// repeats one of them for the same zone within the window returns
+	// the result of the first without touching the API, and one that
+	// arrives while it is being applied waits for it.  Any other change
+	// to the zone through these methods ends the window.  It protects the
+	// API from callers that retry the same change, such as ACME clients
+	// presenting a challenge from several goroutines, at the cost of
+	// not reapplying changes undone elsewhere in the meantime.
+	DedupWindow time.Duration `json:"dedup_window,omitempty"`
+
+	// MaxRecords, when positive, caps how many records a single
+	// AppendRecords, SetRecords or DeleteRecords call may add and remove
+	// together; larger changes fail with a *PolicyError without being
+	// applied.  Replacing a value counts as adding one record and
+	// removing another.  It guards against runaway automation.
+	MaxRecords int `json:"max_records,omitempty"`
+
+	// ReadOnly makes every operation that would change something on the
+	// server, such as AppendRecords, fail with a *ReadOnlyError, while
+	// reads like GetRecords keep working.  It suits dashboards and
+	// staging setups that share credentials with production.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// AllowedZones, when set, lists the only zones the Provider operates
+	// on; any other zone fails with a *PolicyError.  It limits what a
+	// misconfigured caller can do with an API key that is valid for the
+	// whole server.  ListZones only returns these zones.
+	AllowedZones []string `json:"allowed_zones,omitempty"`
+
+	// Protected lists records the Provider refuses to change, as a type
+	// and a name relative to the zone, such as "MX @" or "A www".  Both
+	// may be glob patterns: "* @" protects everything at the apex and
+	// "TXT *._domainkey" the DKIM keys.  Changes to an RRset a pattern
+	// matches fail with a *PolicyError without being applied, whether
+	// they go through the API or an RFC 2136 update.
+	Protected []string `json:"protected,omitempty"`
+
+	// ExpectedZones lists the zones the Provider is meant to manage.
+	// Provision checks that each of them exists and can be changed, so
+	// that a misconfiguration is found at startup rather than when a
+	// certificate is due for renewal.
+	ExpectedZones []string `json:"expected_zones,omitempty"`
 
-	mu        sync.Mutex
-	c         *client
+	// ZoneClient replaces the go-powerdns zones client used for record
+	// management, mainly so that tests can substitute a fake.  The
+	// helpers that talk to other API endpoints still use ServerURL.
+	ZoneClient ZoneClient `json:"-"`
+
+	// TTLPolicy decides what happens when records passed to
+	// AppendRecords or SetRecords for the same name and type have
+	// different TTLs, since PowerDNS keeps one TTL per RRset: "error"
+	// (the default) fails the call, and "first", "min" and "max" use
+	// that TTL for the whole RRset.
+	TTLPolicy string `json:"ttl_policy,omitempty"`
+
+	// mu guards the lazily built client.  Every operation takes it for
+	// reading, so it is only held for writing while the client is built.
+	mu      sync.RWMutex
+	c       *client
+	cfg     clientConfig
+	breaker *circuitBreaker
+
+	// endpointClients holds the clients built for Endpoints by suffix.
+	endpointClients map[string]*endpointClient
+
+	// The state below is kept per zone, so that operations on different
+	// zones never wait for each other.
+
+	// zoneLocks holds a *sync.Mutex per zone, see lockZone.
+	zoneLocks sync.Map
+
+	// batches holds a *zoneBatch per zone, see enqueue.
+	batches sync.Map
+
+	// challenges holds a *challengeSet per zone, see PresentChallenge.
+	challenges sync.Map
+
+	// stats holds a *zoneStats per zone, see ZoneStats.
+	stats sync.Map
+
+	// recent holds the changes applied within DedupWindow.
+	recent recentChanges
 }
 
 // GetRecords lists all the records in the zone.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	c, err := p.client()
+	var recs []libdns.Record
+	err := p.ForEachRecord(ctx, zone, func(rec libdns.Record) error {
+		recs = append(recs, rec)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	prec, err := c.fullZone(ctx, zone)
+	return recs, nil
+}
+
+// appendLDRecords appends the values of rRSet to recs as libdns records.
+// TXT content split into 255 byte strings is joined again.
+func appendLDRecords(recs []libdns.Record, zone string, rRSet zones.ResourceRecordSet) []libdns.Record {
+	for _, v := range rRSet.Records {
+		value := v.Content
+		if hasTXTContent(rRSet.Type) {
+			value = joinTXT(value)
+		}
+		recs = append(recs, libdns.Record{
+			ID:       recordID(rRSet.Name, rRSet.Type, v.Content),
+			Type:     rRSet.Type,
+			Name:     libdns.RelativeName(rRSet.Name, zone),
+			Value:    value,
+			TTL:      time.Second * time.Duration(rRSet.TTL),
+			Priority: 0,
+		})
+	}
+	return recs
+}
+
+// recordID returns the ID of a record, which is derived from its absolute
+// name, type and value so that it is stable across calls and unique within
+// the zone.
+func recordID(name, rrType, value string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.TrimSuffix(name, ".")) + ".|" + rrType + "|" + value))
+	return hex.EncodeToString(h[:8])
+}
+
+// resolveIDs replaces records that carry nothing but an ID with the record
+// in the zone that has that ID.  IDs that match no record are dropped, as
+// the record they named is already gone.
+func (p *Provider) resolveIDs(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	want := make(map[string]bool)
+	for _, rec := range records {
+		if rec.ID != "" && rec.Type == "" && rec.Value == "" {
+			want[rec.ID] = true
+		}
+	}
+	if len(want) == 0 {
+		return records, nil
+	}
+	found := make(map[string]libdns.Record, len(want))
+	err := p.ForEachRecord(ctx, zone, func(rec libdns.Record) error {
+		if want[rec.ID] {
+			found[rec.ID] = rec
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	recs := make([]libdns.Record, 0, len(prec.ResourceRecordSets))
-	for _, rec := range prec.ResourceRecordSets {
-		for _, v := range rec.Records {
-			recs = append(recs, libdns.Record{
-				ID:       prec.ID,
-				Type:     rec.Type,
-				Name:     libdns.RelativeName(rec.Name, zone),
-				Value:    v.Content,
-				TTL:      time.Second * time.Duration(rec.TTL),
-				Priority: 0,
-			})
+	out := make([]libdns.Record, 0, len(records))
+	for _, rec := range records {
+		if want[rec.ID] {
+			if f, ok := found[rec.ID]; ok {
+				out = append(out, f)
+			}
+			continue
 		}
+		out = append(out, rec)
 	}
-	return recs, nil
+	return out, nil
 }
 
-// AppendRecords adds records to the zone. It returns the records that were added.
+// AppendRecords adds records to the zone. It returns the records that were added,
+// as they are stored on the server; records the zone already had are left
+// out, so an append that changed nothing returns none.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	records, err := p.prepareRecords(ctx, zone, records, OperationAppend)
+	if err != nil {
+		return nil, err
+	}
+	return p.deduplicate(zone, OperationAppend, records, func() ([]libdns.Record, error) {
+		return p.appendRecords(ctx, zone, records)
+	})
+}
+
+// appendRecords applies the normalized records of AppendRecords.
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if p.BatchWindow > 0 && p.Transport != TransportRFC2136 {
+		return p.enqueue(ctx, zone, OperationAppend, records)
+	}
+	defer p.lockZone(zone)()
+
+	if p.Transport == TransportRFC2136 {
+		return p.dnsUpdate(ctx, zone, OperationAppend, records)
+	}
+	c, err := p.clientFor(zone)
 	if err != nil {
 		return nil, err
 	}
-	fullZone, err := c.fullZone(ctx, zone)
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, records))
 	if err != nil {
 		return nil, err
 	}
-	rrecs, err := mergeRRecs(fullZone, convertNamesToAbsolute(zone, records))
+	rrecs, err := p.buildChanges(fullZone, zone, records, OperationAppend)
 	if err != nil {
 		return nil, err
 	}
-	err = c.updateRRs(ctx, fullZone.ID, rrecs)
+	err = p.updateRRs(ctx, c, zone, fullZone.ID, rrecs)
 	if err != nil {
 		return nil, err
 	}
-	return records, nil
+	p.countChanges(zone, fullZone, rrecs)
+	return resultRecords(fullZone, rrecs, zone, records, OperationAppend), nil
+}
+
+// AppendRecordsReport is AppendRecords that also returns the records that
+// were skipped because the zone already had them, so that callers can log
+// what an append actually changed.
+func (p *Provider) AppendRecordsReport(ctx context.Context, zone string, records []libdns.Record) (added, skipped []libdns.Record, err error) {
+	added, err = p.AppendRecords(ctx, zone, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	got := make(map[string]bool, len(added))
+	for _, rec := range convertNamesToAbsolute(zone, added) {
+		got[key(rec.Name, rec.Type)+"|"+rec.Value] = true
+	}
+	for _, rec := range convertNamesToAbsolute(zone, p.qualifyTargets(normalizeRecords(records))) {
+		content := rec.Value
+		if hasTXTContent(rec.Type) {
+			rec.Value = joinTXT(rec.Value)
+		}
+		k := key(rec.Name, rec.Type) + "|" + rec.Value
+		if rec.Value == "" || got[k] {
+			continue
+		}
+		got[k] = true
+		rec.ID = recordID(rec.Name, rec.Type, content)
+		rec.Name = libdns.RelativeName(rec.Name, zone)
+		skipped = append(skipped, rec)
+	}
+	return added, skipped, nil
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
-// It returns the updated records.
+// Each RRset named in records ends up holding exactly the values given for
+// it, so existing values that aren't passed in are removed; RRsets not named
+// in records are left alone.  A record with an empty Value stands for an
+// empty RRset: unless values are also given for its name and type, that
+// RRset is deleted.  It returns the updated records, as they are stored
+// on the server.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	records, err := p.prepareRecords(ctx, zone, records, OperationSet)
+	if err != nil {
+		return nil, err
+	}
+	return p.deduplicate(zone, OperationSet, records, func() ([]libdns.Record, error) {
+		return p.setRecords(ctx, zone, records)
+	})
+}
+
+// setRecords applies the normalized records of SetRecords.
+func (p *Provider) setRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if p.BatchWindow > 0 && p.Transport != TransportRFC2136 {
+		return p.enqueue(ctx, zone, OperationSet, records)
+	}
+	defer p.lockZone(zone)()
+
+	if p.Transport == TransportRFC2136 {
+		return p.dnsUpdate(ctx, zone, OperationSet, records)
+	}
+	c, err := p.clientFor(zone)
 	if err != nil {
 		return nil, err
 	}
-	zID, err := c.zoneID(ctx, zone)
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, records))
 	if err != nil {
 		return nil, err
 	}
-	inHash := makeLDRecHash(convertNamesToAbsolute(zone, records))
-	rRecs := convertLDHash(inHash)
-	err = c.updateRRs(ctx, zID, rRecs)
+	rRecs, err := p.buildChanges(fullZone, zone, records, OperationSet)
 	if err != nil {
 		return nil, err
 	}
-	return records, nil
+	err = p.updateRRs(ctx, c, zone, fullZone.ID, rRecs)
+	if err != nil {
+		return nil, err
+	}
+	p.countChanges(zone, fullZone, rRecs)
+	return resultRecords(fullZone, rRecs, zone, records, OperationSet), nil
 }
 
-// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+// DeleteRecords deletes the records from the zone. It returns the records that were deleted;
+// records that weren't in the zone are left out.
+// A record with an empty Value deletes every record of its name and type,
+// and a record that only has its ID set deletes the record GetRecords
+// returned with that ID.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	records, err := p.prepareRecords(ctx, zone, records, OperationDelete)
+	if err != nil {
+		return nil, err
+	}
+	return p.deduplicate(zone, OperationDelete, records, func() ([]libdns.Record, error) {
+		return p.deleteRecords(ctx, zone, records)
+	})
+}
+
+// deleteRecords applies the normalized records of DeleteRecords.
+func (p *Provider) deleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if p.BatchWindow > 0 && p.Transport != TransportRFC2136 {
+		return p.enqueue(ctx, zone, OperationDelete, records)
+	}
+	defer p.lockZone(zone)()
+
+	if p.Transport == TransportRFC2136 {
+		return p.dnsUpdate(ctx, zone, OperationDelete, records)
+	}
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, records))
 	if err != nil {
 		return nil, err
 	}
-	fullZone, err := c.fullZone(ctx, zone)
+
+	rRSets, err := p.buildChanges(fullZone, zone, records, OperationDelete)
 	if err != nil {
 		return nil, err
 	}
+	err = p.updateRRs(ctx, c, zone, fullZone.ID, rRSets)
+	if err != nil {
+		return nil, err
+	}
+	p.countChanges(zone, fullZone, rRSets)
+
+	return resultRecords(fullZone, rRSets, zone, records, OperationDelete), nil
+}
 
-	rRSets := cullRRecs(fullZone, convertNamesToAbsolute(zone, records))
-	err = c.updateRRs(ctx, fullZone.ID, rRSets)
+// ListZones returns the names of all zones hosted on the server.
+func (p *Provider) ListZones(ctx context.Context) ([]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	zs, err := c.zones.ListZones(ctx, c.sID)
 	if err != nil {
 		return nil, err
 	}
+	names := make([]string, 0, len(zs))
+	for _, z := range zs {
+		if p.zoneAllowed(z.Name) {
+			names = append(names, z.Name)
+		}
+	}
+	return names, nil
+}
 
-	return records, nil
+// defaultTimeout is used when Provider.Timeout is zero.
+const defaultTimeout = time.Minute
 
+// withDeadline bounds ctx by the provider's Timeout unless it already has a
+// deadline.
+func (p *Provider) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || p.Timeout < 0 {
+		return ctx, func() {}
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// lockZone locks zone against other mutations through this Provider and
+// returns the function that unlocks it.
+func (p *Provider) lockZone(zone string) func() {
+	k := strings.ToLower(strings.TrimSuffix(zone, "."))
+	m, _ := p.zoneLocks.LoadOrStore(k, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// updateRRs submits rRSets to the zone and runs any configured follow up
+// actions.  Every change made through the API passes through it, so it is
+// where the Provider's policy is enforced.
+func (p *Provider) updateRRs(ctx context.Context, c *client, zone, zoneID string, rRSets []zones.ResourceRecordSet) error {
+	if err := p.checkPolicy(zone, rRSets); err != nil {
+		return err
+	}
+	err := c.updateRRs(ctx, zoneID, rRSets)
+	if err != nil {
+		return err
+	}
+	if p.VerifyWrites {
+		if err := c.verifyRRSets(ctx, zoneID, rRSets); err != nil {
+			return err
+		}
+	}
+	if p.Rectify {
+		if err := c.rectifyIfNeeded(ctx, zoneID); err != nil {
+			return err
+		}
+	}
+	if p.FlushCache {
+		flushed := make(map[string]bool)
+		for _, rr := range rRSets {
+			name := strings.ToLower(rr.Name)
+			if flushed[name] {
+				continue
+			}
+			flushed[name] = true
+			err = c.flushCache(ctx, rr.Name)
+			if err != nil {
+				return fmt.Errorf("the changes were applied, but flushing %s from the cache failed: %s", rr.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// clientConfig holds the settings the client is built from, so that
+// changes to them can be noticed.
+type clientConfig struct {
+	serverURL, apiPath, serverID, apiToken, view, debug                          string
+	legacyAPI, cacheZones, disableKeepAlives, readOnly                           bool
+	maxIdleConnsPerHost, updateConcurrency, retries, breakerThreshold, patchSize int
+	idleConnTimeout, breakerCooldown, zoneNotFoundTTL                            time.Duration
+}
+
+func (p *Provider) clientConfig() clientConfig {
+	serverID := p.ServerID
+	if serverID == "" {
+		serverID = "localhost"
+	}
+	return clientConfig{
+		serverURL:           p.ServerURL,
+		apiPath:             p.APIPath,
+		serverID:            serverID,
+		apiToken:            p.APIToken,
+		view:                p.View,
+		debug:               p.Debug,
+		legacyAPI:           p.LegacyAPI,
+		cacheZones:          p.CacheZones,
+		disableKeepAlives:   p.DisableKeepAlives,
+		readOnly:            p.ReadOnly,
+		maxIdleConnsPerHost: p.MaxIdleConnsPerHost,
+		updateConcurrency:   p.UpdateConcurrency,
+		patchSize:           p.PatchSize,
+		retries:             p.Retries,
+		breakerThreshold:    p.BreakerThreshold,
+		idleConnTimeout:     p.IdleConnTimeout,
+		breakerCooldown:     p.BreakerCooldown,
+		zoneNotFoundTTL:     p.ZoneNotFoundTTL,
+	}
+}
+
+// Reset discards the API client, along with the zone cache and the
+// circuit breaker state, so that the next operation builds a new one from
+// the Provider's current settings.  Changes to the plain settings, such as
+// ServerURL or APIToken, are noticed without it; Reset is needed after
+// replacing ZoneClient, HTTPTransport, Resolver, DialContext, TokenSource
+// or RetryPolicy.  It must not be called concurrently with changes to the
+// settings.
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.c = nil
+	p.breaker = nil
+	p.endpointClients = nil
 }
 
 func (p *Provider) client() (*client, error) {
+	p.mu.RLock()
+	c, cfg := p.c, p.clientConfig()
+	if c != nil && cfg == p.cfg {
+		p.mu.RUnlock()
+		return c, nil
+	}
+	p.mu.RUnlock()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if p.c == nil {
-		var err error
+	// the settings may have been changed since the client was built
+	if cfg = p.clientConfig(); p.c == nil || cfg != p.cfg {
 		if p.ServerID == "" {
 			p.ServerID = "localhost"
 		}
-		var debug io.Writer
-		switch strings.ToLower(p.Debug) {
-		case "stdout", "yes", "true", "1":
-			debug = os.Stdout
-		case "stderr":
-			debug = os.Stderr
-		}
-		p.c, err = newClient(p.ServerID, p.ServerURL, p.APIToken, debug)
+		c, b, err := p.buildClient(p.ServerURL, p.ServerID, p.APIToken, p.TokenSource)
 		if err != nil {
 			return nil, err
 		}
+		p.c, p.cfg, p.breaker = c, cfg, b
 	}
 	return p.c, nil
 }
 
+// buildClient builds a client for the API at serverURL from the
+// Provider's settings.
+func (p *Provider) buildClient(serverURL, serverID, apiToken string, tokenSource func(ctx context.Context) (string, error)) (*client, *circuitBreaker, error) {
+	var debug io.Writer
+	switch strings.ToLower(p.Debug) {
+	case "stdout", "yes", "true", "1":
+		debug = os.Stdout
+	case "stderr":
+		debug = os.Stderr
+	}
+	if serverURL != "" || p.ZoneClient == nil {
+		var err error
+		serverURL, err = normalizeServerURL(serverURL, p.apiPath())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	c, err := newClient(serverID, serverURL, apiToken, debug)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.view = p.View
+	var b *circuitBreaker
+	c.hc.Transport, b = p.buildTransport(serverURL, tokenSource)
+	if p.CacheZones {
+		c.zoneCache = &zoneCache{}
+	}
+	if p.ZoneNotFoundTTL > 0 {
+		c.missing = newMissingZones(p.ZoneNotFoundTTL)
+	}
+	c.updateWorkers = p.UpdateConcurrency
+	c.patchSize = p.PatchSize
+	c.readOnly = p.ReadOnly
+	switch {
+	case p.ZoneClient != nil:
+		c.zones = p.ZoneClient
+		c.direct = false
+	case p.LegacyAPI:
+		c.apiPrefix = ""
+		c.zones = &legacyZones{c: c}
+		c.direct = false
+	}
+	return c, b, nil
+}
+
 // Interface guards
 var (
 	_ libdns.RecordGetter   = (*Provider)(nil)
@@ -0,0 +1,2487 @@
+package pdnsprovider
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// dumpZone renders every record of the zone as "name type ttl value", sorted.
+func dumpZone(z zones.Zone) []string {
+	var out []string
+	for _, rr := range z.ResourceRecordSets {
+		for _, rec := range rr.Records {
+			out = append(out, fmt.Sprintf("%s %s %d %s", rr.Name, rr.Type, rr.TTL, rec.Content))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestProviderGetRecords(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	var have []string
+	for _, rec := range recs {
+		have = append(have, fmt.Sprintf("%s %s %s %s", rec.Name, rec.Type, rec.TTL, rec.Value))
+	}
+	sort.Strings(have)
+	want := []string{
+		` MX 1h0m0s 10 mail.example.org.`,
+		` NS 1h0m0s ns1.example.org.`,
+		` NS 1h0m0s ns2.example.org.`,
+		` SOA 1h0m0s ns1.example.org. hostmaster.example.org. 2021010101 10800 3600 604800 3600`,
+		`_acme-challenge TXT 1m0s "old-token"`,
+		`www A 5m0s 192.0.2.1`,
+		`www A 5m0s 192.0.2.2`,
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+}
+
+func TestProviderOmitSOAAndNS(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.OmitSOAAndNS = true
+
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	var have []string
+	for _, rec := range recs {
+		have = append(have, rec.Name+" "+rec.Type)
+	}
+	sort.Strings(have)
+	want := []string{" MX", "_acme-challenge TXT", "www A", "www A"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+}
+
+func TestProviderMutations(t *testing.T) {
+	base := dumpZone(testZone())
+	without := func(drop ...string) []string {
+		var out []string
+	outer:
+		for _, s := range base {
+			for _, d := range drop {
+				if s == d {
+					continue outer
+				}
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	with := func(in []string, add ...string) []string {
+		out := append(append([]string(nil), in...), add...)
+		sort.Strings(out)
+		return out
+	}
+
+	for _, table := range []struct {
+		name      string
+		operation Operation
+		records   []libdns.Record
+		want      []string
+	}{
+		{
+			name:      "append to existing RRset",
+			operation: OperationAppend,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+			},
+			want: with(base, "www.example.org. A 300 192.0.2.3"),
+		},
+		{
+			name:      "append existing value",
+			operation: OperationAppend,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+			},
+			want: base,
+		},
+		{
+			name:      "append normalizes input",
+			operation: OperationAppend,
+			records: []libdns.Record{
+				{Name: " WWW", Type: "a", Value: "192.0.2.3 ", TTL: 300 * time.Second},
+				{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+			},
+			want: with(base, "www.example.org. A 300 192.0.2.3"),
+		},
+		{
+			name:      "append new RRset",
+			operation: OperationAppend,
+			records: []libdns.Record{
+				{Name: "mail", Type: "A", Value: "192.0.2.10", TTL: time.Hour},
+				{Name: "mail", Type: "AAAA", Value: "2001:db8::10", TTL: time.Hour},
+			},
+			want: with(base, "mail.example.org. A 3600 192.0.2.10", "mail.example.org. AAAA 3600 2001:db8::10"),
+		},
+		{
+			name:      "append TXT alongside existing",
+			operation: OperationAppend,
+			records: []libdns.Record{
+				{Name: "_acme-challenge", Type: "TXT", Value: `"new-token"`, TTL: time.Minute},
+			},
+			want: with(base, `_acme-challenge.example.org. TXT 60 "new-token"`),
+		},
+		{
+			name:      "set replaces RRset",
+			operation: OperationSet,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.9", TTL: 120 * time.Second},
+			},
+			want: with(without("www.example.org. A 300 192.0.2.1", "www.example.org. A 300 192.0.2.2"),
+				"www.example.org. A 120 192.0.2.9"),
+		},
+		{
+			name:      "set removes stale values",
+			operation: OperationSet,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+				{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+			},
+			want: with(without("www.example.org. A 300 192.0.2.1"), "www.example.org. A 300 192.0.2.3"),
+		},
+		{
+			name:      "set empty value clears RRset",
+			operation: OperationSet,
+			records: []libdns.Record{
+				{Name: "www", Type: "A"},
+				{Name: "gone", Type: "A"},
+			},
+			want: without("www.example.org. A 300 192.0.2.1", "www.example.org. A 300 192.0.2.2"),
+		},
+		{
+			name:      "set creates RRset",
+			operation: OperationSet,
+			records: []libdns.Record{
+				{Name: "ftp", Type: "CNAME", Value: "www.example.org.", TTL: time.Hour},
+			},
+			want: with(base, "ftp.example.org. CNAME 3600 www.example.org."),
+		},
+		{
+			name:      "delete one value",
+			operation: OperationDelete,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.1"},
+			},
+			want: without("www.example.org. A 300 192.0.2.1"),
+		},
+		{
+			name:      "delete last value removes RRset",
+			operation: OperationDelete,
+			records: []libdns.Record{
+				{Name: "_acme-challenge", Type: "TXT", Value: `"old-token"`},
+			},
+			want: without(`_acme-challenge.example.org. TXT 60 "old-token"`),
+		},
+		{
+			name:      "delete empty value removes RRset",
+			operation: OperationDelete,
+			records: []libdns.Record{
+				{Name: "www", Type: "A"},
+			},
+			want: without("www.example.org. A 300 192.0.2.1", "www.example.org. A 300 192.0.2.2"),
+		},
+		{
+			name:      "delete missing value",
+			operation: OperationDelete,
+			records: []libdns.Record{
+				{Name: "www", Type: "A", Value: "192.0.2.99"},
+				{Name: "nothere", Type: "A", Value: "192.0.2.99"},
+			},
+			want: base,
+		},
+	} {
+		t.Run(table.name, func(t *testing.T) {
+			fs := newFakeServer(t, testZone())
+			p := fs.provider()
+
+			_, err := p.apply(context.Background(), "example.org.", table.operation, table.records)
+			if err != nil {
+				t.Fatalf("failed to %s records: %s", table.operation, err)
+			}
+			have := dumpZone(fs.zone("example.org."))
+			if !reflect.DeepEqual(have, table.want) {
+				t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, table.want)
+			}
+		})
+	}
+}
+
+func TestProviderZoneNotFound(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	_, err := p.GetRecords(context.Background(), "example.com.")
+	if err == nil {
+		t.Errorf("expected an error for a missing zone")
+	}
+}
+
+func TestProviderZoneNotFoundTTL(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.ZoneNotFoundTTL = time.Minute
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, "example.net."); err == nil {
+		t.Fatalf("expected an error for a missing zone")
+	}
+	fs.mu.Lock()
+	fs.zones["example.net."] = &zones.Zone{ID: "example.net.", Name: "example.net.", Kind: zones.ZoneKindNative, Serial: 1}
+	fs.mu.Unlock()
+	if _, err := p.GetRecords(ctx, "example.net"); err == nil {
+		t.Errorf("expected the zone to be remembered as missing")
+	}
+	c, err := p.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.missing.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := p.GetRecords(ctx, "example.net."); err != nil {
+		t.Errorf("GetRecords failed once the zone expired from the cache: %s", err)
+	}
+
+	// zones created through the Provider are looked up again at once
+	if _, err := p.GetRecords(ctx, "example.com."); err == nil {
+		t.Fatalf("expected an error for a missing zone")
+	}
+	if err := p.CreateSecondaryZone(ctx, "example.com.", []string{"192.0.2.53"}); err != nil {
+		t.Fatalf("CreateSecondaryZone failed: %s", err)
+	}
+	_, err = p.GetRecords(ctx, "example.com.")
+	var healthErr *ZoneHealthError
+	if !errors.As(err, &healthErr) {
+		t.Errorf("expected the new zone to be found, got %v", err)
+	}
+}
+
+func TestProviderConcurrentUse(t *testing.T) {
+	other := testZone()
+	other.ID = "example.net."
+	other.Name = "example.net."
+	for i := range other.ResourceRecordSets {
+		rr := &other.ResourceRecordSets[i]
+		rr.Name = strings.TrimSuffix(rr.Name, "example.org.") + "example.net."
+	}
+	fs := newFakeServer(t, testZone(), other)
+	p := fs.provider()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*n)
+	for _, zone := range []string{"example.org.", "example.net."} {
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func(zone string, i int) {
+				defer wg.Done()
+				_, err := p.AppendRecords(context.Background(), zone, []libdns.Record{
+					{Name: "_acme-challenge", Type: "TXT", Value: fmt.Sprintf(`"token-%d"`, i), TTL: time.Minute},
+				})
+				errs <- err
+			}(zone, i)
+			go func(zone string) {
+				defer wg.Done()
+				_, err := p.GetRecords(context.Background(), zone)
+				errs <- err
+			}(zone)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent operation failed: %s", err)
+		}
+	}
+
+	for _, zone := range []string{"example.org.", "example.net."} {
+		z := fs.zone(zone)
+		for _, rr := range z.ResourceRecordSets {
+			if rr.Name != "_acme-challenge."+zone || rr.Type != "TXT" {
+				continue
+			}
+			// the original value plus every appended one
+			if len(rr.Records) != n+1 {
+				t.Errorf("%s: have %d TXT values, want %d", zone, len(rr.Records), n+1)
+			}
+		}
+	}
+}
+
+// memZones is an in-memory ZoneClient.
+type memZones struct {
+	mu    sync.Mutex
+	zones map[string]*zones.Zone
+}
+
+func (m *memZones) ListZones(ctx context.Context, serverID string) ([]zones.Zone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []zones.Zone
+	for _, z := range m.zones {
+		out = append(out, zones.Zone{ID: z.ID, Name: z.Name, Serial: z.Serial})
+	}
+	return out, nil
+}
+
+func (m *memZones) ListZone(ctx context.Context, serverID string, zoneName string) ([]zones.Zone, error) {
+	all, _ := m.ListZones(ctx, serverID)
+	var out []zones.Zone
+	for _, z := range all {
+		if z.Name == zoneName {
+			out = append(out, z)
+		}
+	}
+	return out, nil
+}
+
+func (m *memZones) GetZone(ctx context.Context, serverID, zoneID string) (*zones.Zone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	z, ok := m.zones[zoneID]
+	if !ok {
+		return nil, fmt.Errorf("zone %s not found", zoneID)
+	}
+	cp := *z
+	cp.ResourceRecordSets = append([]zones.ResourceRecordSet(nil), z.ResourceRecordSets...)
+	return &cp, nil
+}
+
+func (m *memZones) AddRecordSetToZone(ctx context.Context, serverID string, zoneID string, set zones.ResourceRecordSet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	z, ok := m.zones[zoneID]
+	if !ok {
+		return fmt.Errorf("zone %s not found", zoneID)
+	}
+	return patchZone(z, []zones.ResourceRecordSet{set})
+}
+
+func TestProviderZoneClient(t *testing.T) {
+	z := testZone()
+	p := &Provider{
+		ZoneClient: &memZones{zones: map[string]*zones.Zone{z.ID: &z}},
+	}
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	var have []string
+	for _, rec := range recs {
+		if rec.Name == "www" {
+			have = append(have, rec.Value)
+		}
+	}
+	want := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+}
+
+func TestProviderForEachRecord(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	want, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	var have []libdns.Record
+	err = p.ForEachRecord(context.Background(), "example.org.", func(rec libdns.Record) error {
+		have = append(have, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachRecord failed: %s", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	stop := fmt.Errorf("stop")
+	n := 0
+	err = p.ForEachRecord(context.Background(), "example.org.", func(rec libdns.Record) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("iteration did not stop: err %v after %d records", err, n)
+	}
+}
+
+func TestProviderPartialZoneFetch(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	want := []string{"rrset_name=www.example.org.&rrset_type=A", "rrset_name=example.org.&rrset_type=DNAME"}
+	if !reflect.DeepEqual(fs.gets, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", fs.gets, want)
+	}
+	have := dumpZone(fs.zone("example.org."))
+	if len(have) != len(dumpZone(testZone()))+1 {
+		t.Errorf("unexpected zone contents: %#v", have)
+	}
+}
+
+func TestProviderOwnership(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	ctx := context.Background()
+	a := fs.provider()
+	a.Owner = "a"
+	b := fs.provider()
+	b.Owner = "b"
+
+	svc := []libdns.Record{{Name: "svc", Type: "A", Value: "192.0.2.20", TTL: time.Minute}}
+	if _, err := a.AppendRecords(ctx, "example.org.", svc); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if _, err := a.SetRecords(ctx, "example.org.", svc); err != nil {
+		t.Errorf("owner could not update its own RRset: %s", err)
+	}
+	if _, err := b.DeleteRecords(ctx, "example.org.", svc); err == nil {
+		t.Errorf("expected an error deleting an RRset owned by someone else")
+	}
+	www := []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.9", TTL: time.Minute}}
+	if _, err := a.SetRecords(ctx, "example.org.", www); err == nil {
+		t.Errorf("expected an error replacing an unowned RRset")
+	}
+	if _, err := a.DeleteRecords(ctx, "example.org.", svc); err != nil {
+		t.Errorf("owner could not delete its own RRset: %s", err)
+	}
+
+	snap, err := a.SnapshotZone(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("SnapshotZone failed: %s", err)
+	}
+	other := []libdns.Record{{Name: "other", Type: "A", Value: "192.0.2.21", TTL: time.Minute}}
+	if _, err := b.AppendRecords(ctx, "example.org.", other); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if err := a.RestoreZone(ctx, snap); err == nil {
+		t.Errorf("expected an error restoring over an RRset owned by someone else")
+	}
+	if err := b.RestoreZone(ctx, snap); err != nil {
+		t.Errorf("owner could not restore its own RRset: %s", err)
+	}
+
+	want := dumpZone(testZone())
+	if have := dumpZone(fs.zone("example.org.")); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestProviderBatchWindow(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.BatchWindow = 50 * time.Millisecond
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, fmt.Sprintf(`_acme-challenge.example.org. TXT 60 "token-%d"`, i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+				{Name: "_acme-challenge", Type: "TXT", Value: fmt.Sprintf(`"token-%d"`, i), TTL: time.Minute},
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AppendRecords failed: %s", err)
+		}
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("expected a single patch, got %d", len(fs.patches))
+	}
+	want = append(want, dumpZone(testZone())...)
+	sort.Strings(want)
+	if have := dumpZone(fs.zone("example.org.")); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestProviderRecordIDs(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	again, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if !reflect.DeepEqual(recs, again) {
+		t.Errorf("record IDs are not stable")
+	}
+	ids := make(map[string]bool)
+	var target libdns.Record
+	for _, rec := range recs {
+		if ids[rec.ID] {
+			t.Errorf("duplicate record ID %s", rec.ID)
+		}
+		ids[rec.ID] = true
+		if rec.Name == "www" && rec.Value == "192.0.2.2" {
+			target = rec
+		}
+	}
+
+	_, err = p.DeleteRecords(ctx, "example.org.", []libdns.Record{{ID: target.ID}})
+	if err != nil {
+		t.Fatalf("DeleteRecords failed: %s", err)
+	}
+	var want []string
+	for _, s := range dumpZone(testZone()) {
+		if s != "www.example.org. A 300 192.0.2.2" {
+			want = append(want, s)
+		}
+	}
+	if have := dumpZone(fs.zone("example.org.")); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestProviderGetRecordsFiltered(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	for _, table := range []struct {
+		filter RecordFilter
+		want   []string
+	}{
+		{RecordFilter{Name: "www"}, []string{"www A 192.0.2.1", "www A 192.0.2.2"}},
+		{RecordFilter{Name: "@", Types: []string{"MX"}}, []string{" MX 10 mail.example.org."}},
+		{RecordFilter{Types: []string{"TXT"}}, []string{`_acme-challenge TXT "old-token"`}},
+		{RecordFilter{NamePrefix: "_acme"}, []string{`_acme-challenge TXT "old-token"`}},
+		{RecordFilter{Name: "nothere"}, nil},
+	} {
+		recs, err := p.GetRecordsFiltered(context.Background(), "example.org.", table.filter)
+		if err != nil {
+			t.Fatalf("GetRecordsFiltered failed: %s", err)
+		}
+		var have []string
+		for _, rec := range recs {
+			have = append(have, fmt.Sprintf("%s %s %s", rec.Name, rec.Type, rec.Value))
+		}
+		sort.Strings(have)
+		if !reflect.DeepEqual(have, table.want) {
+			t.Errorf("%+v: have: %#v want %#v", table.filter, have, table.want)
+		}
+	}
+
+	p.OmitSOAAndNS = true
+	recs, err := p.GetRecordsFiltered(context.Background(), "example.org.", RecordFilter{Name: "@"})
+	if err != nil {
+		t.Fatalf("GetRecordsFiltered failed: %s", err)
+	}
+	if len(recs) != 1 || recs[0].Type != "MX" {
+		t.Errorf("expected only the MX record with OmitSOAAndNS, got %#v", recs)
+	}
+}
+
+func TestProviderDisabledRecords(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	www := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second}
+	changed, err := p.SetRecordsDisabled(ctx, "example.org.", []libdns.Record{www}, true)
+	if err != nil {
+		t.Fatalf("SetRecordsDisabled failed: %s", err)
+	}
+	if len(changed) != 1 {
+		t.Errorf("expected one changed record, got %#v", changed)
+	}
+
+	disabled := func() []string {
+		recs, err := p.GetRecordsWithState(ctx, "example.org.")
+		if err != nil {
+			t.Fatalf("GetRecordsWithState failed: %s", err)
+		}
+		var out []string
+		for _, rec := range recs {
+			if rec.Disabled {
+				out = append(out, rec.Name+" "+rec.Value)
+			}
+		}
+		return out
+	}
+	want := []string{"www 192.0.2.1"}
+	if have := disabled(); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+
+	// replacing and appending keep the disabled value disabled
+	_, err = p.SetRecords(ctx, "example.org.", []libdns.Record{www, {Name: "www", Type: "A", Value: "192.0.2.5", TTL: 300 * time.Second}})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	_, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.6", TTL: 300 * time.Second}})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if have := disabled(); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+
+	// values are matched in the form they are stored in
+	changed, err = p.SetRecordsDisabled(ctx, "example.org.", []libdns.Record{
+		{Name: "@", Type: "mx", Value: "mail.example.org", Priority: 10},
+		{Name: "_acme-challenge", Type: "TXT", Value: "old-token"},
+	}, true)
+	if err != nil {
+		t.Fatalf("SetRecordsDisabled failed: %s", err)
+	}
+	if len(changed) != 2 {
+		t.Errorf("expected two changed records, got %#v", changed)
+	}
+	want = []string{" 10 mail.example.org.", "www 192.0.2.1", `_acme-challenge "old-token"`}
+	if have := disabled(); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+
+	if _, err := p.SetRecordsDisabled(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.99"}}, true); err == nil {
+		t.Errorf("expected an error for records that aren't in the zone")
+	}
+	// records already in the requested state still match
+	if changed, err := p.SetRecordsDisabled(ctx, "example.org.", []libdns.Record{www}, true); err != nil || len(changed) != 0 {
+		t.Errorf("expected no changes, got %#v, %v", changed, err)
+	}
+}
+
+func TestProviderKeepsComments(t *testing.T) {
+	want := testZone().ResourceRecordSets[3].Comments
+	for _, op := range []Operation{OperationAppend, OperationSet, OperationDelete} {
+		fs := newFakeServer(t, testZone())
+		p := fs.provider()
+
+		// a value that makes each operation change the RRset
+		value := "192.0.2.3"
+		if op == OperationDelete {
+			value = "192.0.2.2"
+		}
+		_, err := p.apply(context.Background(), "example.org.", op, []libdns.Record{
+			{Name: "www", Type: "A", Value: value, TTL: 300 * time.Second},
+		})
+		if err != nil {
+			t.Fatalf("failed to %s records: %s", op, err)
+		}
+		if len(fs.patches) != 1 || len(fs.patches[0]) != 1 {
+			t.Fatalf("%s: unexpected patches %#v", op, fs.patches)
+		}
+		if have := fs.patches[0][0].Comments; !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: assertion failed: have: %#v want %#v", op, have, want)
+		}
+	}
+}
+
+func TestProviderVerifyWrites(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.VerifyWrites = true
+	recs := []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second}}
+
+	if _, err := p.AppendRecords(context.Background(), "example.org.", recs); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	fs.mu.Lock()
+	fs.dropPatches = true
+	fs.mu.Unlock()
+	if _, err := p.DeleteRecords(context.Background(), "example.org.", recs); err == nil {
+		t.Errorf("expected a verification error for a dropped patch")
+	}
+}
+
+func TestProviderAPIError(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	fs.rejectPatches = "RRset www.example.org. IN A: Conflicts with pre-existing RRset"
+	p := fs.provider()
+
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %#v", err)
+	}
+	if apiErr.StatusCode != 422 || apiErr.Message != fs.rejectPatches {
+		t.Errorf("unexpected error details: %#v", apiErr)
+	}
+}
+
+func TestProviderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: fakeAPIKey, Timeout: 50 * time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.GetRecords(context.Background(), "example.org.")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected a timeout error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("GetRecords did not time out")
+	}
+}
+
+func TestProviderTokenSource(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.APIToken = ""
+	calls := 0
+	var mu sync.Mutex
+	p.TokenSource = func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return fakeAPIKey, nil
+	}
+
+	if _, err := p.GetRecords(context.Background(), "example.org."); err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if calls == 0 {
+		t.Errorf("token source was not used")
+	}
+}
+
+func TestProviderAPIPath(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/pdns/dns/v1/") {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		r.URL.Path = "/api/v1" + strings.TrimPrefix(r.URL.Path, "/pdns/dns/v1")
+		r.URL.RawPath = ""
+		fs.serveHTTP(w, r)
+	}))
+	defer proxy.Close()
+	p := &Provider{ServerURL: proxy.URL + "/pdns", APIPath: "/dns/v1/", APIToken: fakeAPIKey}
+
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if have := dumpZone(fs.zone("example.org.")); len(have) != len(dumpZone(testZone()))+1 {
+		t.Errorf("unexpected zone contents: %#v", have)
+	}
+}
+
+// gzipWriter compresses everything written to the response.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w gzipWriter) Write(b []byte) (int, error) {
+	return w.gz.Write(b)
+}
+
+func TestProviderGzip(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	compressed := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			fs.serveHTTP(w, r)
+			return
+		}
+		compressed++
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		fs.serveHTTP(gzipWriter{w, gz}, r)
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: fakeAPIKey}
+
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if len(recs) != len(dumpZone(testZone())) {
+		t.Errorf("unexpected records: %#v", recs)
+	}
+	if compressed == 0 {
+		t.Errorf("no request asked for gzip")
+	}
+}
+
+func TestProviderWatchZone(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := p.WatchZone(ctx, "example.org.", 0, func(ZoneEvent) {}); err == nil {
+		t.Errorf("expected an error for a zero interval")
+	}
+
+	events := make(chan ZoneEvent, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.WatchZone(ctx, "example.org.", 10*time.Millisecond, func(ev ZoneEvent) {
+			events <- ev
+		})
+	}()
+	// let the watch read the zone before it changes
+	for fetched := 0; fetched == 0; time.Sleep(time.Millisecond) {
+		fs.mu.Lock()
+		fetched = len(fs.gets)
+		fs.mu.Unlock()
+	}
+	_, err := p.AppendRecords(context.Background(), "example.org.", []libdns.Record{
+		{Name: "new", Type: "A", Value: "192.0.2.9", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Serial != ev.OldSerial+1 || len(ev.Changes) != 1 || ev.Changes[0].RRSet.Name != "new.example.org." {
+			t.Errorf("unexpected event %#v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event for the change")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected the watch to end with the context, got %v", err)
+	}
+}
+
+func TestProviderCacheZones(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.CacheZones = true
+	ctx := context.Background()
+
+	first, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	second, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached zone differs:\nhave: %#v\nwant: %#v", second, first)
+	}
+	if fs.notModified != 1 {
+		t.Errorf("expected the second fetch to be a 304, got %d", fs.notModified)
+	}
+
+	// a change must not be hidden by the cache
+	_, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	third, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if len(third) != len(first)+1 {
+		t.Errorf("expected %d records after the change, got %d", len(first)+1, len(third))
+	}
+
+	// snapshots don't share the cached zone
+	snap, err := p.SnapshotZone(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("SnapshotZone failed: %s", err)
+	}
+	for i := range snap.RRSets {
+		for j := range snap.RRSets[i].Records {
+			snap.RRSets[i].Records[j].Content = "changed"
+		}
+	}
+	fourth, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if !reflect.DeepEqual(fourth, third) {
+		t.Errorf("changing the snapshot changed the cached zone:\nhave: %#v\nwant: %#v", fourth, third)
+	}
+}
+
+func TestProviderUpdateConcurrency(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.UpdateConcurrency = 4
+
+	var recs []libdns.Record
+	want := dumpZone(testZone())
+	for i := 0; i < 10; i++ {
+		recs = append(recs, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1", TTL: time.Minute})
+		want = append(want, fmt.Sprintf("host%d.example.org. A 60 192.0.2.1", i))
+	}
+	sort.Strings(want)
+	if _, err := p.SetRecords(context.Background(), "example.org.", recs); err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	if len(fs.patches) != len(recs) {
+		t.Errorf("expected %d patches, got %d", len(recs), len(fs.patches))
+	}
+	if have := dumpZone(fs.zone("example.org.")); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	fs.mu.Lock()
+	fs.rejectPatches = "nope"
+	fs.mu.Unlock()
+	if _, err := p.DeleteRecords(context.Background(), "example.org.", recs); err == nil {
+		t.Errorf("expected an error when patches fail")
+	}
+}
+
+func TestProviderPatchSize(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.PatchSize = 4
+
+	var recs []libdns.Record
+	for i := 0; i < 10; i++ {
+		recs = append(recs, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1", TTL: time.Minute})
+	}
+	if _, err := p.SetRecords(context.Background(), "example.org.", recs); err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	if len(fs.patches) != 3 || len(fs.patches[0]) != 4 || len(fs.patches[2]) != 2 {
+		t.Fatalf("expected patches of 4, 4 and 2 RRsets, got %d patches", len(fs.patches))
+	}
+	if fs.patches[0][0].Name != "host0.example.org." || fs.patches[2][1].Name != "host9.example.org." {
+		t.Errorf("patches weren't applied in order: %#v", fs.patches)
+	}
+
+	fs.mu.Lock()
+	fs.patchLimit = 4
+	fs.mu.Unlock()
+	_, err := p.DeleteRecords(context.Background(), "example.org.", recs)
+	var partial *PartialUpdateError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a *PartialUpdateError, got %v", err)
+	}
+	if partial.Patch != 2 || partial.Patches != 3 || len(partial.Applied) != 4 || len(partial.Failed) != 4 || len(partial.Pending) != 2 {
+		t.Errorf("unexpected partial update %d/%d applied %d failed %d pending %d", partial.Patch, partial.Patches, len(partial.Applied), len(partial.Failed), len(partial.Pending))
+	}
+	if !strings.Contains(err.Error(), "patch limit reached") {
+		t.Errorf("expected the server's error in %q", err)
+	}
+}
+
+func TestProviderGetRecordsMulti(t *testing.T) {
+	other := testZone()
+	other.ID, other.Name = "example.net.", "example.net."
+	for i := range other.ResourceRecordSets {
+		rr := &other.ResourceRecordSets[i]
+		rr.Name = strings.TrimSuffix(rr.Name, "example.org.") + "example.net."
+	}
+	fs := newFakeServer(t, testZone(), other)
+	p := fs.provider()
+	p.ZoneConcurrency = 1
+
+	results := p.GetRecordsMulti(context.Background(), []string{"example.org.", "example.net.", "missing.org."})
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, zone := range []string{"example.org.", "example.net."} {
+		res := results[zone]
+		if res.Err != nil {
+			t.Errorf("%s: unexpected error: %s", zone, res.Err)
+		}
+		if len(res.Records) != 7 {
+			t.Errorf("%s: expected 7 records, got %d", zone, len(res.Records))
+		}
+	}
+	if results["missing.org."].Err == nil {
+		t.Errorf("expected an error for a missing zone")
+	}
+}
+
+func TestProviderSetRecordsUnchanged(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patch for an unchanged RRset, got %d", len(fs.patches))
+	}
+
+	// a TTL change alone replaces the RRset
+	_, err = p.SetRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second},
+		{Name: "_acme-challenge", Type: "TXT", Value: `"old-token"`, TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	if len(fs.patches) != 1 || len(fs.patches[0]) != 1 || fs.patches[0][0].Type != "TXT" {
+		t.Errorf("expected a single patch of the TXT RRset, got %#v", fs.patches)
+	}
+}
+
+func TestProviderMutationResults(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.TTLPolicy = TTLPolicyFirst
+	ctx := context.Background()
+
+	set, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "Mail", Type: "A", Value: "192.0.2.10", TTL: time.Hour},
+		{Name: "mail", Type: "A", Value: "192.0.2.11", TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	stored := make(map[libdns.Record]bool)
+	for _, rec := range recs {
+		stored[rec] = true
+	}
+	if len(set) != 2 {
+		t.Fatalf("expected 2 records, got %#v", set)
+	}
+	for _, rec := range set {
+		if !stored[rec] {
+			t.Errorf("returned record %#v is not as stored", rec)
+		}
+	}
+
+	deleted, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A"},
+		{Name: "mail", Type: "A", Value: "192.0.2.99"},
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecords failed: %s", err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("expected the 2 www records, got %#v", deleted)
+	}
+	for _, rec := range deleted {
+		if !stored[rec] || rec.Name != "www" {
+			t.Errorf("deleted record %#v is not as stored", rec)
+		}
+	}
+}
+
+func TestProviderTTLPolicy(t *testing.T) {
+	records := []libdns.Record{
+		{Name: "Mail", Type: "A", Value: "192.0.2.10", TTL: time.Hour},
+		{Name: "mail", Type: "A", Value: "192.0.2.11", TTL: time.Minute},
+		{Name: "mail", Type: "AAAA", Value: "2001:db8::10", TTL: time.Second},
+	}
+	for _, table := range []struct {
+		policy string
+		want   time.Duration
+	}{
+		{policy: TTLPolicyFirst, want: time.Hour},
+		{policy: TTLPolicyMin, want: time.Minute},
+		{policy: TTLPolicyMax, want: time.Hour},
+	} {
+		t.Run(table.policy, func(t *testing.T) {
+			fs := newFakeServer(t, testZone())
+			p := fs.provider()
+			p.TTLPolicy = table.policy
+			if _, err := p.SetRecords(context.Background(), "example.org.", records); err != nil {
+				t.Fatalf("SetRecords failed: %s", err)
+			}
+			for _, rr := range fs.zone("example.org.").ResourceRecordSets {
+				if rr.Name != "mail.example.org." {
+					continue
+				}
+				want := table.want
+				if rr.Type == "AAAA" {
+					want = time.Second
+				}
+				if have := time.Duration(rr.TTL) * time.Second; have != want {
+					t.Errorf("%s TTL: have %s, want %s", rr.Type, have, want)
+				}
+			}
+		})
+	}
+
+	fs := newFakeServer(t, testZone())
+	if _, err := fs.provider().AppendRecords(context.Background(), "example.org.", records); err == nil {
+		t.Errorf("expected conflicting TTLs to be rejected by default")
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected nothing to be submitted, got %d patches", len(fs.patches))
+	}
+}
+
+func TestProviderPTR(t *testing.T) {
+	reverse := zones.Zone{ID: "2.0.192.in-addr.arpa.", Name: "2.0.192.in-addr.arpa.", Serial: 1}
+	reverse.ResourceRecordSets = []zones.ResourceRecordSet{{
+		Name:    "200.2.0.192.in-addr.arpa.",
+		Type:    "CNAME",
+		TTL:     3600,
+		Records: []zones.Record{{Content: "200.128-255.2.0.192.in-addr.arpa."}},
+	}}
+	classless := zones.Zone{ID: "0-63.2.0.192.in-addr.arpa.", Name: "0-63.2.0.192.in-addr.arpa.", Serial: 1}
+	delegated := zones.Zone{ID: "128-255.2.0.192.in-addr.arpa.", Name: "128-255.2.0.192.in-addr.arpa.", Serial: 1}
+	v6 := zones.Zone{ID: "8.b.d.0.1.0.0.2.ip6.arpa.", Name: "8.b.d.0.1.0.0.2.ip6.arpa.", Serial: 1}
+	fs := newFakeServer(t, reverse, classless, delegated, v6)
+	p := fs.provider()
+	ctx := context.Background()
+
+	for _, table := range []struct {
+		ip, zone, name string
+	}{
+		{"192.0.2.10", "0-63.2.0.192.in-addr.arpa.", "10.0-63.2.0.192.in-addr.arpa."},
+		{"192.0.2.100", "2.0.192.in-addr.arpa.", "100.2.0.192.in-addr.arpa."},
+		{"192.0.2.200", "128-255.2.0.192.in-addr.arpa.", "200.128-255.2.0.192.in-addr.arpa."},
+		{"2001:db8::1", "8.b.d.0.1.0.0.2.ip6.arpa.", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	} {
+		if err := p.SetPTR(ctx, net.ParseIP(table.ip), "host.example.org", time.Hour); err != nil {
+			t.Fatalf("SetPTR %s failed: %s", table.ip, err)
+		}
+		found := false
+		for _, rr := range fs.zone(table.zone).ResourceRecordSets {
+			if rr.Name == table.name && rr.Type == "PTR" {
+				found = len(rr.Records) == 1 && rr.Records[0].Content == "host.example.org."
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected a PTR at %s in %s", table.ip, table.name, table.zone)
+		}
+		if err := p.DeletePTR(ctx, net.ParseIP(table.ip)); err != nil {
+			t.Fatalf("DeletePTR %s failed: %s", table.ip, err)
+		}
+		for _, rr := range fs.zone(table.zone).ResourceRecordSets {
+			if rr.Type == "PTR" {
+				t.Errorf("%s: PTR %s left behind", table.ip, rr.Name)
+			}
+		}
+	}
+}
+
+func TestProviderDNAME(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "legacy", Type: "DNAME", Value: "example.net", TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	want := append(dumpZone(testZone()), "legacy.example.org. DNAME 3600 example.net.")
+	sort.Strings(want)
+	if have := dumpZone(fs.zone("example.org.")); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+
+	for _, table := range []struct {
+		name    string
+		records []libdns.Record
+	}{
+		{
+			name:    "CNAME next to a DNAME",
+			records: []libdns.Record{{Name: "legacy", Type: "CNAME", Value: "www.example.org.", TTL: time.Hour}},
+		},
+		{
+			name:    "two DNAMEs",
+			records: []libdns.Record{{Name: "legacy", Type: "DNAME", Value: "example.com.", TTL: time.Hour}},
+		},
+		{
+			name:    "DNAME above existing data",
+			records: []libdns.Record{{Name: "", Type: "DNAME", Value: "example.com.", TTL: time.Hour}},
+		},
+		{
+			name:    "data below a DNAME",
+			records: []libdns.Record{{Name: "www.Legacy", Type: "A", Value: "192.0.2.9", TTL: time.Hour}},
+		},
+		{
+			name:    "data further below a DNAME",
+			records: []libdns.Record{{Name: "a.b.legacy", Type: "TXT", Value: `"x"`, TTL: time.Hour}},
+		},
+	} {
+		if _, err := p.AppendRecords(ctx, "example.org.", table.records); err == nil {
+			t.Errorf("%s: expected an error", table.name)
+		}
+	}
+}
+
+func TestProviderSOA(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	soa, err := p.GetSOA(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetSOA failed: %s", err)
+	}
+	want := SOA{MName: "ns1.example.org.", RName: "hostmaster.example.org.", Serial: 2021010101, Refresh: 10800, Retry: 3600, Expire: 604800, Minimum: 3600}
+	if soa != want {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", soa, want)
+	}
+
+	updated, err := p.UpdateSOA(ctx, "example.org.", func(s *SOA) {
+		s.RName = "dns.example.org."
+		s.Minimum = 300
+	})
+	if err != nil {
+		t.Fatalf("UpdateSOA failed: %s", err)
+	}
+	want.RName, want.Minimum, want.Serial = "dns.example.org.", 300, want.Serial+1
+	if updated != want {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", updated, want)
+	}
+	if soa, _ := p.GetSOA(ctx, "example.org."); soa != want {
+		t.Errorf("stored SOA %#v, want %#v", soa, want)
+	}
+
+	if _, err := p.UpdateSOA(ctx, "example.org.", func(s *SOA) { s.Serial = 1 }); err == nil {
+		t.Errorf("expected an error for a serial going back")
+	}
+	_, err = p.SetRecords(ctx, "example.org.", []libdns.Record{
+		{Type: "SOA", Value: "ns1.example.org. hostmaster.example.org. 2020010101 10800 3600 604800 3600", TTL: time.Hour},
+	})
+	if err == nil {
+		t.Errorf("expected SetRecords to refuse a serial going back")
+	}
+}
+
+func TestProviderRecordComments(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+
+	recs, err := p.GetRecordsWithState(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecordsWithState failed: %s", err)
+	}
+	want := []zones.Comment{{Content: "web servers", Account: "ops", ModifiedAt: 1600000000}}
+	n := 0
+	for _, rec := range recs {
+		switch {
+		case rec.Name == "www":
+			n++
+			if !reflect.DeepEqual(rec.Comments, want) {
+				t.Errorf("%s: assertion failed: have: %#v want %#v", rec.Value, rec.Comments, want)
+			}
+		case len(rec.Comments) > 0:
+			t.Errorf("%s %s: unexpected comments %#v", rec.Name, rec.Type, rec.Comments)
+		}
+	}
+	if n != 2 {
+		t.Errorf("expected 2 www records, got %d", n)
+	}
+}
+
+func TestProviderPresigned(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	sig := []libdns.Record{{
+		Name:  "www",
+		Type:  "RRSIG",
+		Value: "A 13 3 300 20300101000000 20200101000000 12345 example.org. c2lnbmF0dXJl",
+		TTL:   300 * time.Second,
+	}}
+	if _, err := p.AppendRecords(ctx, "example.org.", sig); err == nil {
+		t.Errorf("expected RRSIG records to be refused in a zone that isn't presigned")
+	}
+
+	if err := p.SetPresigned(ctx, "example.org.", true); err != nil {
+		t.Fatalf("SetPresigned failed: %s", err)
+	}
+	if presigned, err := p.Presigned(ctx, "example.org."); err != nil || !presigned {
+		t.Errorf("expected the zone to be presigned, got %v, %v", presigned, err)
+	}
+	if info, err := p.GetZoneInfo(ctx, "example.org."); err != nil || !info.Presigned {
+		t.Errorf("expected the zone info to show the zone presigned, got %+v, %v", info, err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", sig); err != nil {
+		t.Errorf("AppendRecords failed: %s", err)
+	}
+
+	if err := p.SetPresigned(ctx, "example.org.", false); err != nil {
+		t.Fatalf("SetPresigned failed: %s", err)
+	}
+	if presigned, err := p.Presigned(ctx, "example.org."); err != nil || presigned {
+		t.Errorf("expected the zone not to be presigned, got %v, %v", presigned, err)
+	}
+}
+
+func TestProviderRectify(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.Rectify = true
+	ctx := context.Background()
+	txt := []libdns.Record{{Name: "txt", Type: "TXT", Value: `"hello"`, TTL: time.Minute}}
+
+	// unsigned zones need no rectify
+	if _, err := p.AppendRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if len(fs.rectified) != 0 {
+		t.Errorf("expected no rectify of an unsigned zone, got %v", fs.rectified)
+	}
+
+	fs.mu.Lock()
+	fs.dnssec["example.org."] = true
+	fs.mu.Unlock()
+	if _, err := p.DeleteRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("DeleteRecords failed: %s", err)
+	}
+	if want := []string{"example.org."}; !reflect.DeepEqual(fs.rectified, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", fs.rectified, want)
+	}
+
+	if err := p.SetAPIRectify(ctx, "example.org.", true); err != nil {
+		t.Fatalf("SetAPIRectify failed: %s", err)
+	}
+	if on, err := p.APIRectify(ctx, "example.org."); err != nil || !on {
+		t.Errorf("expected API-RECTIFY to be on, got %v, %v", on, err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if len(fs.rectified) != 1 {
+		t.Errorf("expected no rectify with API-RECTIFY on, got %v", fs.rectified)
+	}
+}
+
+func TestProviderAlsoNotify(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if err := p.AddAlsoNotify(ctx, "example.org.", "192.0.2.1", "[2001:db8::1]:5300"); err != nil {
+		t.Fatalf("AddAlsoNotify failed: %s", err)
+	}
+	if err := p.AddAlsoNotify(ctx, "example.org.", "192.0.2.1", "192.0.2.2:53"); err != nil {
+		t.Fatalf("AddAlsoNotify failed: %s", err)
+	}
+	if err := p.AddAlsoNotify(ctx, "example.org.", "ns1.example.org"); err == nil {
+		t.Errorf("expected an error for a host name")
+	}
+	if err := p.RemoveAlsoNotify(ctx, "example.org.", "[2001:db8::1]:5300"); err != nil {
+		t.Fatalf("RemoveAlsoNotify failed: %s", err)
+	}
+	have, err := p.AlsoNotify(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("AlsoNotify failed: %s", err)
+	}
+	if want := []string{"192.0.2.1", "192.0.2.2:53"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+}
+
+func TestProviderAllowAXFRFrom(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if err := p.AddAllowAXFRFrom(ctx, "example.org.", AllowAXFRAutoNS, "192.0.2.0/24", "2001:db8::53"); err != nil {
+		t.Fatalf("AddAllowAXFRFrom failed: %s", err)
+	}
+	if err := p.AddAllowAXFRFrom(ctx, "example.org.", "192.0.2.0/33"); err == nil {
+		t.Errorf("expected an error for an invalid network")
+	}
+	if err := p.RemoveAllowAXFRFrom(ctx, "example.org.", "192.0.2.0/24"); err != nil {
+		t.Fatalf("RemoveAllowAXFRFrom failed: %s", err)
+	}
+	have, err := p.AllowAXFRFrom(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("AllowAXFRFrom failed: %s", err)
+	}
+	if want := []string{AllowAXFRAutoNS, "2001:db8::53"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", have, want)
+	}
+}
+
+func TestProviderSecondaryZones(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if err := p.CreateSecondaryZone(ctx, "example.net", []string{"192.0.2.53"}); err != nil {
+		t.Fatalf("CreateSecondaryZone failed: %s", err)
+	}
+	if z := fs.zone("example.net."); z.Kind != zones.ZoneKindSlave || !reflect.DeepEqual(z.Masters, []string{"192.0.2.53"}) {
+		t.Errorf("unexpected secondary zone %#v", z)
+	}
+	_, err := p.GetRecords(ctx, "example.net.")
+	var healthErr *ZoneHealthError
+	if !errors.As(err, &healthErr) || !strings.Contains(err.Error(), "never transferred from 192.0.2.53") {
+		t.Errorf("expected a zone health error for an untransferred zone, got %v", err)
+	}
+	if _, err := p.GetRecordsFiltered(ctx, "example.net.", RecordFilter{Name: "@"}); !errors.As(err, &healthErr) {
+		t.Errorf("expected a zone health error from GetRecordsFiltered, got %v", err)
+	}
+	if err := p.SetMasters(ctx, "example.net.", []string{"192.0.2.53", "[2001:db8::53]:5300"}); err != nil {
+		t.Fatalf("SetMasters failed: %s", err)
+	}
+	masters, err := p.Masters(ctx, "example.net.")
+	if err != nil {
+		t.Fatalf("Masters failed: %s", err)
+	}
+	if want := []string{"192.0.2.53", "[2001:db8::53]:5300"}; !reflect.DeepEqual(masters, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", masters, want)
+	}
+
+	if err := p.MakeSecondary(ctx, "example.org.", nil); err == nil {
+		t.Errorf("expected an error without masters")
+	}
+	if err := p.MakeSecondary(ctx, "example.org.", []string{"192.0.2.54"}); err != nil {
+		t.Fatalf("MakeSecondary failed: %s", err)
+	}
+	if z := fs.zone("example.org."); z.Kind != zones.ZoneKindSlave || !reflect.DeepEqual(z.Masters, []string{"192.0.2.54"}) {
+		t.Errorf("zone wasn't converted: kind %d, masters %v", z.Kind, z.Masters)
+	}
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords failed on a transferred secondary zone: %s", err)
+	}
+}
+
+func TestProviderProvision(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if err := p.Provision(ctx); err != nil {
+		t.Errorf("Provision failed without expected zones: %s", err)
+	}
+	p.ExpectedZones = []string{"example.org."}
+	if err := p.Provision(ctx); err != nil {
+		t.Errorf("Provision failed: %s", err)
+	}
+
+	if err := p.CreateSecondaryZone(ctx, "example.net.", []string{"192.0.2.53"}); err != nil {
+		t.Fatalf("CreateSecondaryZone failed: %s", err)
+	}
+	p.ExpectedZones = []string{"example.org.", "example.net.", "missing.org."}
+	err := p.Provision(ctx)
+	if err == nil {
+		t.Fatalf("expected an error for the missing and secondary zones")
+	}
+	for _, want := range []string{"2 of 3", "example.net.: zone example.net. is unhealthy", "missing.org.: zone not found"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err)
+		}
+	}
+
+	fs.mu.Lock()
+	fs.readOnly = true
+	fs.mu.Unlock()
+	p.ExpectedZones = []string{"example.org."}
+	if err := p.Provision(ctx); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("expected a read-only error, got %v", err)
+	}
+}
+
+func TestProviderServers(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	servers, err := p.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers failed: %s", err)
+	}
+	if len(servers) != 1 || servers[0].ID != "localhost" {
+		t.Errorf("unexpected servers %#v", servers)
+	}
+	if err := p.CheckServerID(ctx); err != nil {
+		t.Errorf("CheckServerID failed: %s", err)
+	}
+
+	config, err := p.ServerConfig(ctx)
+	if err != nil {
+		t.Fatalf("ServerConfig failed: %s", err)
+	}
+	if config["api-readonly"] != "no" || config["default-soa-content"] == "" {
+		t.Errorf("unexpected config %#v", config)
+	}
+
+	p = fs.provider()
+	p.ServerID = "elsewhere"
+	if err := p.CheckServerID(ctx); err == nil || !strings.Contains(err.Error(), `"localhost"`) {
+		t.Errorf("expected an error listing the valid servers, got %v", err)
+	}
+}
+
+func TestProviderFlushCache(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.FlushCache = true
+	ctx := context.Background()
+
+	_, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "www", Type: "AAAA", Value: "2001:db8::1", TTL: 300 * time.Second},
+		{Name: "_acme-challenge", Type: "TXT", Value: `"old-token"`, TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	// the TXT value was already there, so only www changed
+	if want := []string{"www.example.org."}; !reflect.DeepEqual(fs.flushed, want) {
+		t.Errorf("assertion failed: have: %#v want %#v", fs.flushed, want)
+	}
+	if len(fs.patches) != 1 || len(fs.patches[0]) != 1 {
+		t.Errorf("expected a single changed RRset, got %#v", fs.patches)
+	}
+}
+
+func TestProviderZoneStats(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords failed: %s", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "txt", Type: "TXT", Value: `"a"`}}); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second}}); err != nil {
+		t.Fatalf("SetRecords failed: %s", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "_acme-challenge", Type: "TXT"}}); err != nil {
+		t.Fatalf("DeleteRecords failed: %s", err)
+	}
+
+	stats, ok := p.ZoneStats()["example.org."]
+	if !ok {
+		t.Fatalf("no stats for example.org.: %#v", p.ZoneStats())
+	}
+	if stats.RRSets != 5 || stats.Records != 7 || stats.Fetches != 1 || stats.FetchedBytes == 0 {
+		t.Errorf("unexpected fetch stats %#v", stats)
+	}
+	if stats.Added != 1 || stats.Deleted != 2 {
+		t.Errorf("expected 1 record added and 2 deleted, got %#v", stats)
+	}
+}
+
+func TestProviderAppendReport(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	added, skipped, err := p.AppendRecordsReport(ctx, "example.org.", []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: 300 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecordsReport failed: %s", err)
+	}
+	if len(added) != 1 || added[0].Value != "192.0.2.3" {
+		t.Errorf("expected only 192.0.2.3 to be added, got %#v", added)
+	}
+	if len(skipped) != 1 || skipped[0].Value != "192.0.2.1" || skipped[0].Name != "www" || skipped[0].ID == "" {
+		t.Errorf("expected 192.0.2.1 to be skipped, got %#v", skipped)
+	}
+
+	patches := len(fs.patches)
+	added, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.2", TTL: 300 * time.Second}})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if len(added) != 0 || len(fs.patches) != patches {
+		t.Errorf("expected nothing to be added or patched, got %#v", added)
+	}
+}
+
+func TestProviderApexGuard(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	for _, table := range []struct {
+		op      func() error
+		comment string
+	}{
+		{func() error {
+			_, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "SOA"}})
+			return err
+		}, "deleting the SOA"},
+		{func() error {
+			_, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+				{Name: "@", Type: "NS", Value: "ns1.example.org."},
+				{Name: "@", Type: "NS", Value: "ns2.example.org."},
+			})
+			return err
+		}, "deleting every NS record"},
+		{func() error {
+			_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{{Name: "", Type: "NS"}})
+			return err
+		}, "setting an empty NS RRset"},
+		{func() error {
+			return p.DeleteRRset(ctx, "example.org.", "@", "NS")
+		}, "DeleteRRset of the NS RRset"},
+		{func() error {
+			snap, err := p.SnapshotZone(ctx, "example.org.")
+			if err != nil {
+				return err
+			}
+			rRSets := snap.RRSets[:0:0]
+			for _, rr := range snap.RRSets {
+				if rr.Type != "NS" {
+					rRSets = append(rRSets, rr)
+				}
+			}
+			snap.RRSets = rRSets
+			return p.RestoreZone(ctx, snap)
+		}, "RestoreZone of a snapshot without NS records"},
+	} {
+		var policyErr *PolicyError
+		if err := table.op(); !errors.As(err, &policyErr) || !strings.Contains(policyErr.Reason, "needs AllowApexRemoval") {
+			t.Errorf("%s: expected to be refused, got %v", table.comment, err)
+		}
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patches, got %d", len(fs.patches))
+	}
+
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "NS", Value: "ns2.example.org."}}); err != nil {
+		t.Errorf("deleting one of the NS records failed: %s", err)
+	}
+	p.AllowApexRemoval = true
+	if err := p.DeleteRRset(ctx, "example.org.", "", "NS"); err != nil {
+		t.Errorf("DeleteRRset failed with AllowApexRemoval: %s", err)
+	}
+}
+
+func TestProviderProtected(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.Protected = []string{"MX @", "a WWW", "TXT *._domainkey"}
+	ctx := context.Background()
+
+	for _, table := range []struct {
+		records []libdns.Record
+		comment string
+	}{
+		{[]libdns.Record{{Name: "@", Type: "MX", Value: "20 mx2.example.org."}}, "apex MX"},
+		{[]libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.9"}}, "www A"},
+		{[]libdns.Record{{Name: "sel._domainkey", Type: "TXT", Value: `"v=DKIM1"`}}, "DKIM key"},
+	} {
+		var policyErr *PolicyError
+		if _, err := p.AppendRecords(ctx, "example.org.", table.records); !errors.As(err, &policyErr) || !strings.Contains(policyErr.Reason, "protected by") {
+			t.Errorf("%s: expected to be refused, got %v", table.comment, err)
+		}
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A"}}); err == nil {
+		t.Errorf("expected deleting www A to be refused")
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patches, got %d", len(fs.patches))
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "AAAA", Value: "2001:db8::1"}}); err != nil {
+		t.Errorf("AppendRecords of an unprotected type failed: %s", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "_acme-challenge", Type: "TXT"}}); err != nil {
+		t.Errorf("DeleteRecords of an unprotected record failed: %s", err)
+	}
+
+	// the other ways of changing RRsets are guarded as well
+	patches := len(fs.patches)
+	var policyErr *PolicyError
+	if _, err := p.SetZoneTTL(ctx, "example.org.", time.Hour, RecordFilter{}); !errors.As(err, &policyErr) {
+		t.Errorf("expected SetZoneTTL to be refused, got %v", err)
+	}
+	if _, err := p.SetRecordsDisabled(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1"}}, true); !errors.As(err, &policyErr) {
+		t.Errorf("expected SetRecordsDisabled to be refused, got %v", err)
+	}
+	snap, err := p.SnapshotZone(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("SnapshotZone failed: %s", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "AAAA", Value: "2001:db8::2"}}); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if err := p.RestoreZone(ctx, snap); err != nil {
+		t.Errorf("RestoreZone of an unprotected RRset failed: %s", err)
+	}
+	for i, rr := range snap.RRSets {
+		if rr.Type == "MX" {
+			snap.RRSets[i].Records = []zones.Record{{Content: "20 mx2.example.org."}}
+		}
+	}
+	if err := p.RestoreZone(ctx, snap); !errors.As(err, &policyErr) {
+		t.Errorf("expected RestoreZone of the MX RRset to be refused, got %v", err)
+	}
+	if have, want := len(fs.patches), patches+2; have != want {
+		t.Errorf("expected %d patches, got %d", want, have)
+	}
+	if have := fs.zone("example.org.").ResourceRecordSets; len(have) != 5 {
+		t.Errorf("the zone wasn't restored: %#v", have)
+	}
+
+	p.Protected = []string{"MX"}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "MX"}}); err == nil || !strings.Contains(err.Error(), "invalid protected record pattern") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+}
+
+func TestProviderAllowedZones(t *testing.T) {
+	other := testZone()
+	other.ID, other.Name = "example.net.", "example.net."
+	fs := newFakeServer(t, testZone(), other)
+	p := fs.provider()
+	p.AllowedZones = []string{"Example.org"}
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords failed for an allowed zone: %s", err)
+	}
+	var policyErr *PolicyError
+	if _, err := p.GetRecords(ctx, "example.net."); !errors.As(err, &policyErr) || policyErr.Zone != "example.net." {
+		t.Errorf("expected a policy error, got %v", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.net.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.9"}}); !errors.As(err, &policyErr) {
+		t.Errorf("expected a policy error, got %v", err)
+	}
+	if _, err := p.ApplyMultiZone(ctx, OperationAppend, []libdns.Record{{Name: "www.example.net.", Type: "A", Value: "192.0.2.9"}}); !errors.As(err, &policyErr) {
+		t.Errorf("expected a policy error, got %v", err)
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patches, got %d", len(fs.patches))
+	}
+
+	names, err := p.ListZones(ctx)
+	if err != nil {
+		t.Fatalf("ListZones failed: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"example.org."}) {
+		t.Errorf("expected only the allowed zone, got %v", names)
+	}
+}
+
+func TestProviderReadOnly(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.ReadOnly = true
+	ctx := context.Background()
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil || len(recs) != 7 {
+		t.Fatalf("GetRecords failed: %d records, %v", len(recs), err)
+	}
+	var readOnlyErr *ReadOnlyError
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "new", Type: "A", Value: "192.0.2.9"}}); !errors.As(err, &readOnlyErr) {
+		t.Errorf("AppendRecords: expected a *ReadOnlyError, got %v", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.1", TTL: 300 * time.Second}}); !errors.As(err, &readOnlyErr) {
+		t.Errorf("AppendRecords of an existing record: expected a *ReadOnlyError, got %v", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", recs[len(recs)-1:]); !errors.As(err, &readOnlyErr) {
+		t.Errorf("DeleteRecords: expected a *ReadOnlyError, got %v", err)
+	}
+	if err := p.DeleteRRset(ctx, "example.org.", "www", "A"); !errors.As(err, &readOnlyErr) {
+		t.Errorf("DeleteRRset: expected a *ReadOnlyError, got %v", err)
+	}
+	if err := p.Notify(ctx, "example.org."); !errors.As(err, &readOnlyErr) {
+		t.Errorf("Notify: expected a *ReadOnlyError, got %v", err)
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patches, got %d", len(fs.patches))
+	}
+
+	p.ReadOnly = false
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "new", Type: "A", Value: "192.0.2.9"}}); err != nil {
+		t.Errorf("AppendRecords failed once ReadOnly was cleared: %s", err)
+	}
+}
+
+func TestProviderMaxRecords(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.MaxRecords = 3
+	ctx := context.Background()
+
+	var recs []libdns.Record
+	for i := 0; i < 4; i++ {
+		recs = append(recs, libdns.Record{Name: fmt.Sprintf("host%d", i), Type: "A", Value: "192.0.2.1"})
+	}
+	var policyErr *PolicyError
+	if _, err := p.AppendRecords(ctx, "example.org.", recs); !errors.As(err, &policyErr) || !strings.Contains(err.Error(), "MaxRecords") {
+		t.Errorf("expected a MaxRecords error, got %v", err)
+	}
+	if len(fs.patches) != 0 {
+		t.Errorf("expected no patches, got %d", len(fs.patches))
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", recs[:3]); err != nil {
+		t.Errorf("AppendRecords failed within MaxRecords: %s", err)
+	}
+
+	// replacing both www values adds two records and removes two
+	www := []libdns.Record{
+		{Name: "www", Type: "A", Value: "192.0.2.7", TTL: 300 * time.Second},
+		{Name: "www", Type: "A", Value: "192.0.2.8", TTL: 300 * time.Second},
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", www); !errors.As(err, &policyErr) {
+		t.Errorf("expected a MaxRecords error, got %v", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A"}}); err != nil {
+		t.Errorf("DeleteRecords failed within MaxRecords: %s", err)
+	}
+}
+
+func TestProviderDedupWindow(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.DedupWindow = time.Minute
+	ctx := context.Background()
+
+	challenge := []libdns.Record{{Name: "_acme-challenge", Type: "TXT", Value: `"token"`, TTL: time.Minute}}
+	if _, err := p.AppendRecords(ctx, "example.org.", challenge); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	fs.mu.Lock()
+	patches, gets := len(fs.patches), len(fs.gets)
+	fs.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs, err := p.AppendRecords(ctx, "example.org", challenge)
+			if err != nil || len(recs) != 1 {
+				t.Errorf("repeated AppendRecords returned %#v, %v", recs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	fs.mu.Lock()
+	if len(fs.patches) != patches || len(fs.gets) != gets {
+		t.Errorf("expected repeats not to reach the API, got %d patches and %d fetches more", len(fs.patches)-patches, len(fs.gets)-gets)
+	}
+	fs.mu.Unlock()
+
+	// a different change ends the window
+	if _, err := p.DeleteRecords(ctx, "example.org.", challenge); err != nil {
+		t.Fatalf("DeleteRecords failed: %s", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", challenge); err != nil {
+		t.Fatalf("AppendRecords failed: %s", err)
+	}
+	if len(fs.patches) != patches+2 {
+		t.Errorf("expected the delete and the second append to be applied, got %d patches more", len(fs.patches)-patches)
+	}
+}
+
+func TestProviderPlanMatchesApply(t *testing.T) {
+	changes := []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "new-token", TTL: time.Minute},
+		{Name: "ftp", Type: "CNAME", Value: "files", TTL: time.Hour},
+		{Name: "@", Type: "SPF", Value: `"v=spf1 -all"`, TTL: time.Hour},
+		{Name: "www", Type: "A", Value: "192.0.2.3", TTL: time.Minute},
+		{Name: "www", Type: "A", Value: "192.0.2.4", TTL: time.Hour},
+	}
+	deletions := []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "old-token"},
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+	}
+	for _, table := range []struct {
+		op      Operation
+		records []libdns.Record
+		apply   func(*Provider, context.Context, string, []libdns.Record) ([]libdns.Record, error)
+	}{
+		{OperationAppend, changes, (*Provider).AppendRecords},
+		{OperationSet, changes, (*Provider).SetRecords},
+		{OperationDelete, deletions, (*Provider).DeleteRecords},
+	} {
+		fs := newFakeServer(t, testZone())
+		p := fs.provider()
+		p.MirrorSPF = true
+		p.TTLPolicy = TTLPolicyMax
+		p.Warnf = func(string, ...interface{}) {}
+		ctx := context.Background()
+
+		plan, err := p.PlanChanges(ctx, "example.org.", table.records, table.op)
+		if err != nil {
+			t.Fatalf("%s: PlanChanges failed: %s", table.op, err)
+		}
+		var planned []zones.ResourceRecordSet
+		for _, ch := range plan {
+			planned = append(planned, ch.RRSet)
+		}
+		if _, err := table.apply(p, ctx, "example.org.", table.records); err != nil {
+			t.Fatalf("%s failed: %s", table.op, err)
+		}
+		if len(fs.patches) != 1 {
+			t.Fatalf("%s: expected a single patch, got %d", table.op, len(fs.patches))
+		}
+		if !reflect.DeepEqual(planned, fs.patches[0]) {
+			t.Errorf("%s: the plan differs from the applied patch:\nplanned: %#v\napplied: %#v", table.op, planned, fs.patches[0])
+		}
+	}
+}
+
+func TestProviderZonesDontContend(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.BatchWindow = time.Millisecond
+	ctx := context.Background()
+
+	// hold every per zone lock of another zone
+	defer p.lockZone("other.org.")()
+	cs := p.challengeSet("other.org.")
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	zb := p.zoneBatch("other.org")
+	zb.mu.Lock()
+	defer zb.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.PresentChallenge(ctx, "example.org.", "www.example.org.", "token")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a mutation of example.org. waited for the locks of other.org.")
+	}
+}
+
+func TestProviderChallengesShareBatch(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	p.BatchWindow = 50 * time.Millisecond
+	ctx := context.Background()
+
+	const n = 5
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			errs <- p.PresentChallenge(ctx, "example.org.", fmt.Sprintf("host%d.example.org.", i), "token")
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("PresentChallenge failed: %s", err)
+		}
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("expected the challenges to share a patch, got %d", len(fs.patches))
+	}
+	for i := 0; i < n; i++ {
+		if err := p.CleanupChallenge(ctx, "example.org.", fmt.Sprintf("host%d.example.org.", i), "token"); err != nil {
+			t.Fatalf("CleanupChallenge failed: %s", err)
+		}
+	}
+	if have, want := dumpZone(fs.zone("example.org.")), dumpZone(testZone()); !reflect.DeepEqual(have, want) {
+		t.Errorf("assertion failed:\nhave: %#v\nwant: %#v", have, want)
+	}
+	if cs := p.challengeSet("example.org."); len(cs.locks) != 0 || len(cs.counts) != 0 {
+		t.Errorf("challenge state was left behind: %v %v", cs.locks, cs.counts)
+	}
+}
+
+func TestProviderReconfigure(t *testing.T) {
+	fs1 := newFakeServer(t, testZone())
+	other := testZone()
+	other.ResourceRecordSets = other.ResourceRecordSets[:1]
+	fs2 := newFakeServer(t, other)
+	p := fs1.provider()
+	ctx := context.Background()
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 7 {
+		t.Fatalf("expected 7 records from the first server, got %d", len(recs))
+	}
+
+	p.ServerURL = fs2.URL
+	recs, err = p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Errorf("the changed ServerURL was not used, got %d records", len(recs))
+	}
+
+	p.APIToken = "wrong"
+	if _, err = p.GetRecords(ctx, "example.org."); err == nil {
+		t.Errorf("the changed APIToken was not used")
+	}
+
+	p.APIToken = fakeAPIKey
+	c, _ := p.client()
+	p.Reset()
+	if c2, _ := p.client(); c2 == c {
+		t.Errorf("Reset kept the client")
+	}
+}
+
+func TestProviderEndpoints(t *testing.T) {
+	fs1 := newFakeServer(t, testZone())
+	fs2 := newFakeServer(t, zones.Zone{
+		Name: "example.net.",
+		ResourceRecordSets: []zones.ResourceRecordSet{
+			{Name: "example.net.", Type: "SOA", TTL: 3600, Records: []zones.Record{{Content: "ns1.example.net. hostmaster.example.net. 1 10800 3600 604800 3600"}}},
+		},
+	})
+	p := fs1.provider()
+	p.Endpoints = map[string]Endpoint{"Example.NET.": {ServerURL: fs2.URL}}
+	ctx := context.Background()
+
+	rec := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.9", TTL: time.Hour}
+	if _, err := p.AppendRecords(ctx, "example.net.", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs1.patches) != 1 || len(fs2.patches) != 1 {
+		t.Errorf("expected one patch on each server, got %d and %d", len(fs1.patches), len(fs2.patches))
+	}
+	recs, err := p.GetRecords(ctx, "example.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Errorf("expected 2 records in example.net., got %d", len(recs))
+	}
+
+	// the longest suffix wins, and its key is used
+	p.Endpoints["sub.example.net"] = Endpoint{ServerURL: fs2.URL, APIToken: "wrong"}
+	if _, err := p.GetRecords(ctx, "sub.example.net."); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected the endpoint's key to be rejected, got %v", err)
+	}
+	if _, err := p.GetRecords(ctx, "example.net."); err != nil {
+		t.Errorf("a shorter suffix was affected: %s", err)
+	}
+}
+
+func TestProviderEndpointCircuitStats(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	p := fs.provider()
+	p.BreakerThreshold = 1
+	p.Endpoints = map[string]Endpoint{"example.net": {ServerURL: failing.URL}}
+	ctx := context.Background()
+
+	if _, err := p.GetRecords(ctx, "example.net."); err == nil {
+		t.Fatalf("expected the failing endpoint to fail")
+	}
+	if s := p.EndpointCircuitStats("Example.NET."); s.State != CircuitOpen || s.Opened != 1 {
+		t.Errorf("expected the endpoint's circuit to open, got %+v", s)
+	}
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.CircuitStats(); s.State != CircuitClosed || s.Failures != 0 {
+		t.Errorf("the endpoint's failures reached the Provider's circuit: %+v", s)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	fs1 := newFakeServer(t, testZone())
+	netZone := zones.Zone{
+		Name: "example.net.",
+		ResourceRecordSets: []zones.ResourceRecordSet{
+			{Name: "example.net.", Type: "SOA", TTL: 3600, Records: []zones.Record{{Content: "ns1.example.net. hostmaster.example.net. 1 10800 3600 604800 3600"}}},
+		},
+	}
+	fs2 := newFakeServer(t, netZone)
+	r := &Router{Backends: map[string]*Provider{"eu": fs1.provider(), "us": fs2.provider()}}
+	ctx := context.Background()
+
+	name, _, err := r.Backend(ctx, "Example.NET")
+	if err != nil || name != "us" {
+		t.Fatalf("expected example.net. on us, got %q, %v", name, err)
+	}
+	rec := libdns.Record{Name: "www", Type: "A", Value: "192.0.2.9", TTL: time.Hour}
+	if _, err := r.AppendRecords(ctx, "example.net.", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SetRecords(ctx, "example.org.", []libdns.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs1.patches) != 1 || len(fs2.patches) != 1 {
+		t.Errorf("expected one patch on each backend, got %d and %d", len(fs1.patches), len(fs2.patches))
+	}
+	zs, err := r.ListZones(ctx)
+	if err != nil || !reflect.DeepEqual(zs, []string{"example.net.", "example.org."}) {
+		t.Errorf("unexpected zones %v, %v", zs, err)
+	}
+
+	if _, err := r.GetRecords(ctx, "example.com."); err == nil {
+		t.Errorf("expected an error for a zone no backend hosts")
+	}
+
+	// a zone that appears on a backend later is found on the next miss
+	fs1.mu.Lock()
+	other := netZone
+	other.ID, other.Name = "example.com.", "example.com."
+	fs1.zones[other.ID] = &other
+	fs1.mu.Unlock()
+	if name, _, err := r.Backend(ctx, "example.com."); err != nil || name != "eu" {
+		t.Errorf("expected example.com. on eu, got %q, %v", name, err)
+	}
+
+	fs2.mu.Lock()
+	fs2.zones[other.ID] = &other
+	fs2.mu.Unlock()
+	if err := r.Refresh(ctx); err == nil {
+		t.Errorf("expected an error for a zone on two backends")
+	}
+}
+
+func TestProviderSetZoneTTL(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	changed, err := p.SetZoneTTL(ctx, "example.org.", time.Minute, RecordFilter{Types: []string{"A", "MX"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 3 || len(fs.patches) != 1 || len(fs.patches[0]) != 2 {
+		t.Fatalf("expected 3 records in 2 RRsets in one patch, got %v and %v", changed, fs.patches)
+	}
+	z := fs.zones["example.org."]
+	for _, rr := range z.ResourceRecordSets {
+		want := map[string]int{"SOA": 3600, "NS": 3600, "MX": 60, "A": 60, "TXT": 60}[rr.Type]
+		if rr.TTL != want {
+			t.Errorf("%s %s: TTL %d, expected %d", rr.Name, rr.Type, rr.TTL, want)
+		}
+		if rr.Type == "A" && len(rr.Comments) != 1 {
+			t.Errorf("the comments of %s were lost", rr.Name)
+		}
+	}
+
+	// RRsets that already have the TTL are left out
+	changed, err = p.SetZoneTTL(ctx, "example.org.", time.Minute, RecordFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 3 || len(fs.patches) != 2 || len(fs.patches[1]) != 2 {
+		t.Errorf("expected the SOA and NS records in one patch, got %v and %v", changed, fs.patches[1:])
+	}
+
+	if _, err := p.SetZoneTTL(ctx, "example.org.", 0, RecordFilter{}); err == nil {
+		t.Errorf("expected an error for a zero TTL")
+	}
+}
+
+func TestProviderDeleteRRset(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	if err := p.DeleteRRset(ctx, "example.org.", "www", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.patches) != 1 || len(fs.patches[0]) != 1 || fs.patches[0][0].ChangeType != zones.ChangeTypeDelete {
+		t.Fatalf("expected a single delete, got %v", fs.patches)
+	}
+	if rr := fs.patches[0][0]; rr.Name != "www.example.org." || rr.Type != "A" {
+		t.Errorf("deleted the wrong RRset %s %s", rr.Name, rr.Type)
+	}
+	for _, rr := range fs.zones["example.org."].ResourceRecordSets {
+		if rr.Type == "A" {
+			t.Errorf("the RRset was not deleted")
+		}
+	}
+	if len(fs.gets) != 0 {
+		t.Errorf("the zone's records were read: %v", fs.gets)
+	}
+
+	// RRsets not owned by Owner are left alone
+	p.Owner = "acme"
+	if err := p.DeleteRRset(ctx, "example.org.", "@", "MX"); err == nil {
+		t.Errorf("expected an ownership error")
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("an unowned RRset was deleted")
+	}
+}
+
+func TestProviderGetZoneInfo(t *testing.T) {
+	z := testZone()
+	z.Account = "customer-1"
+	fs := newFakeServer(t, z)
+	fs.dnssec["example.org."] = true
+	p := fs.provider()
+
+	info, err := p.GetZoneInfo(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ZoneInfo{
+		ID:        "example.org.",
+		Name:      "example.org.",
+		Kind:      zones.ZoneKindNative,
+		Serial:    2021010101,
+		DNSSec:    true,
+		Account:   "customer-1",
+		LastCheck: time.Unix(fakeLastCheck, 0),
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, expected %+v", info, want)
+	}
+	if len(fs.gets) != 0 {
+		t.Errorf("the zone's records were read: %v", fs.gets)
+	}
+
+	if _, err := p.GetZoneInfo(context.Background(), "example.com."); err == nil {
+		t.Errorf("expected an error for an unknown zone")
+	}
+}
+
+func TestProviderPatchRRsets(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	rr := zones.ResourceRecordSet{
+		Name:       "www.example.org.",
+		Type:       "A",
+		TTL:        600,
+		ChangeType: zones.ChangeTypeReplace,
+		Records:    []zones.Record{{Content: "192.0.2.1"}, {Content: "192.0.2.3", Disabled: true}},
+		Comments:   []zones.Comment{{Content: "moved", Account: "ops"}},
+	}
+	del := zones.ResourceRecordSet{Name: "_acme-challenge.example.org.", Type: "TXT", ChangeType: zones.ChangeTypeDelete}
+	if err := p.PatchRRsets(ctx, "example.org.", []zones.ResourceRecordSet{rr, del}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.patches) != 1 || !reflect.DeepEqual(fs.patches[0][0], rr) {
+		t.Errorf("the RRsets were not submitted as given: %v", fs.patches)
+	}
+	if zone := strings.Join(dumpZone(*fs.zones["example.org."]), "\n"); strings.Contains(zone, "TXT") || !strings.Contains(zone, "192.0.2.3") {
+		t.Errorf("the patch was not applied:\n%s", zone)
+	}
+
+	for _, bad := range []zones.ResourceRecordSet{
+		{Name: "www", Type: "A", ChangeType: zones.ChangeTypeDelete},
+		{Name: "www.example.com.", Type: "A", ChangeType: zones.ChangeTypeDelete},
+		{Name: "www.example.org.", ChangeType: zones.ChangeTypeDelete},
+		{Name: "www.example.org.", Type: "A"},
+	} {
+		if err := p.PatchRRsets(ctx, "example.org.", []zones.ResourceRecordSet{bad}); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("an invalid patch was submitted")
+	}
+}
+
+func TestProviderLongTXT(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOC", 12)
+	rec := libdns.Record{Name: "mail._domainkey", Type: "TXT", Value: dkim, TTL: time.Hour}
+	got, err := p.SetRecords(ctx, "example.org.", []libdns.Record{rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := fs.patches[0][0].Records[0].Content
+	if stored != `"`+dkim[:255]+`" "`+dkim[255:]+`"` {
+		t.Errorf("the value was not split: %s", stored)
+	}
+	want := `"` + dkim + `"`
+	if len(got) != 1 || got[0].Value != want {
+		t.Errorf("expected the joined value to be returned, got %v", got)
+	}
+
+	recs, err := p.GetRecordsFiltered(ctx, "example.org.", RecordFilter{Name: "mail._domainkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Value != want {
+		t.Fatalf("expected the joined value to be read, got %v", recs)
+	}
+
+	// what was read can be written back unchanged and deleted
+	if _, err := p.SetRecords(ctx, "example.org.", recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("writing back the value changed the zone: %v", fs.patches[1:])
+	}
+	deleted, err := p.DeleteRecords(ctx, "example.org.", recs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(fs.patches) != 2 {
+		t.Errorf("the record was not deleted: %v", deleted)
+	}
+}
+
+func TestProviderSPF(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	var warnings []string
+	p.Warnf = func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	ctx := context.Background()
+	spf := libdns.Record{Name: "", Type: "SPF", Value: `"v=spf1 mx -all"`, TTL: time.Hour}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{spf}); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || len(fs.patches[0]) != 1 {
+		t.Errorf("expected an SPF record and a warning, got %v and %v", fs.patches, warnings)
+	}
+
+	p.MirrorSPF = true
+	spf.Value = `"v=spf1 mx a -all"`
+	got, err := p.SetRecords(ctx, "example.org.", []libdns.Record{spf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || len(warnings) != 2 {
+		t.Errorf("expected the SPF and TXT records and a warning, got %v and %v", got, warnings)
+	}
+	recs, err := p.GetRecordsFiltered(ctx, "example.org.", RecordFilter{Name: "@", Types: []string{"SPF", "TXT"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Value != spf.Value || recs[1].Value != spf.Value {
+		t.Errorf("expected the SPF policy in both types, got %v", recs)
+	}
+
+	deleted, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{spf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || len(warnings) != 2 {
+		t.Errorf("expected both records deleted without a warning, got %v and %v", deleted, warnings)
+	}
+
+	// clearing SPF records leaves the TXT records alone
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{spf}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Type: "SPF"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].Type != "SPF" {
+		t.Errorf("expected only the SPF record deleted, got %v", deleted)
+	}
+}
+
+func TestProviderQualifyTargets(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	p := fs.provider()
+	ctx := context.Background()
+
+	in := []libdns.Record{
+		{Name: "alias", Type: "CNAME", Value: "www.example.net", TTL: time.Hour},
+		{Name: "", Type: "MX", Value: "20 backup.example.org", TTL: time.Hour},
+		{Name: "_sip._tcp", Type: "SRV", Value: "0 5 5060 sip.example.org", TTL: time.Hour},
+		{Name: "sub", Type: "NS", Value: "ns.example.net", TTL: time.Hour},
+		{Name: "", Type: "MX", Value: "0 .", TTL: time.Hour},
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", in); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"www.example.net.":          true,
+		"20 backup.example.org.":    true,
+		"0 5 5060 sip.example.org.": true,
+		"ns.example.net.":           true,
+		"0 .":                       true,
+	}
+	for _, rr := range fs.patches[0] {
+		for _, r := range rr.Records {
+			delete(want, r.Content)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("targets were not qualified, missing %v in %v", want, fs.patches[0])
+	}
+
+	// what is read back is written back without changes
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", recs); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.patches) != 1 {
+		t.Errorf("writing back the records changed the zone: %v", fs.patches[1:])
+	}
+}
@@ -0,0 +1,62 @@
+package pdnsprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Provision checks that the Provider is usable before it is relied on: the
+// client must be buildable from the settings, and each of ExpectedZones
+// must exist, be healthy, not be a secondary zone and live on a server
+// whose API isn't read-only.  Every problem found is reported in the
+// returned error.  It is meant to be called once at startup.
+func (p *Provider) Provision(ctx context.Context) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	if _, err := p.client(); err != nil {
+		return err
+	}
+	var problems []string
+	readOnly := make(map[*client]bool)
+	for _, zone := range p.ExpectedZones {
+		if err := p.checkWritable(ctx, zone, readOnly); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", zone, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d expected zones can't be managed: %s", len(problems), len(p.ExpectedZones), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkWritable returns an error if records of zone can't be changed.
+// readOnly remembers the api-readonly setting of the servers already
+// asked.
+func (p *Provider) checkWritable(ctx context.Context, zone string, readOnly map[*client]bool) error {
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	z, err := c.healthyZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if isSecondary(z.Kind) {
+		return errors.New("secondary zone, changes would be undone by the next transfer")
+	}
+	ro, ok := readOnly[c]
+	if !ok {
+		config, err := c.serverConfig(ctx)
+		if err != nil {
+			return err
+		}
+		ro = config["api-readonly"] == "yes"
+		readOnly[c] = ro
+	}
+	if ro {
+		return errors.New("the server's API is read-only (api-readonly)")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ReverseName returns the fully qualified in-addr.arpa. or ip6.arpa. name
+// that the PTR records of ip are published under.
+func ReverseName(ip net.IP) (string, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return "", fmt.Errorf("invalid IP address %v", ip)
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip16) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip16[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip16[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String(), nil
+}
+
+// SetPTR points the reverse name of ip at target, replacing the PTR records
+// it had.  The reverse zone is found on the server, following RFC 2317
+// classless delegations to the zone of the subnet.
+func (p *Provider) SetPTR(ctx context.Context, ip net.IP, target string, ttl time.Duration) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zone, name, err := p.ptrLocation(ctx, ip)
+	if err != nil {
+		return err
+	}
+	_, err = p.SetRecords(ctx, zone, []libdns.Record{{
+		Name:  name,
+		Type:  "PTR",
+		Value: strings.TrimSuffix(target, ".") + ".",
+		TTL:   ttl,
+	}})
+	return err
+}
+
+// DeletePTR removes the PTR records of ip.
+func (p *Provider) DeletePTR(ctx context.Context, ip net.IP) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	zone, name, err := p.ptrLocation(ctx, ip)
+	if err != nil {
+		return err
+	}
+	_, err = p.DeleteRecords(ctx, zone, []libdns.Record{{Name: name, Type: "PTR"}})
+	return err
+}
+
+// ptrLocation returns the zone the PTR records of ip belong in, and their
+// name relative to it.  A classless delegation is recognized either by a
+// CNAME from the reverse name into the subnet's zone, or by a zone on the
+// server named after a range that covers the address, such as
+// "0-63.2.0.192.in-addr.arpa." or "0/26.2.0.192.in-addr.arpa.".
+func (p *Provider) ptrLocation(ctx context.Context, ip net.IP) (zone, name string, err error) {
+	fqdn, err := ReverseName(ip)
+	if err != nil {
+		return "", "", err
+	}
+	c, err := p.clientForName(fqdn)
+	if err != nil {
+		return "", "", err
+	}
+	zone, err = c.findZone(ctx, fqdn)
+	if err != nil {
+		return "", "", err
+	}
+
+	cname := libdns.Record{Name: fqdn, Type: "CNAME"}
+	z, err := c.partialZone(ctx, zone, []libdns.Record{cname})
+	if err != nil {
+		return "", "", err
+	}
+	for _, rr := range z.ResourceRecordSets {
+		if strings.EqualFold(rr.Name, fqdn) && rr.Type == "CNAME" && len(rr.Records) > 0 {
+			fqdn = strings.ToLower(rr.Records[0].Content)
+			zone, err = c.findZone(ctx, fqdn)
+			if err != nil {
+				return "", "", err
+			}
+			return zone, libdns.RelativeName(fqdn, zone), nil
+		}
+	}
+
+	if ip4 := ip.To4(); ip4 != nil && strings.EqualFold(zone, strings.SplitN(fqdn, ".", 2)[1]) {
+		// the address's /24 zone may delegate the subnet without a CNAME
+		names, err := p.ListZones(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		for _, n := range names {
+			label := strings.SplitN(n, ".", 2)
+			if len(label) == 2 && strings.EqualFold(label[1], zone) && rangeCovers(label[0], int(ip4[3])) {
+				return n, strconv.Itoa(int(ip4[3])), nil
+			}
+		}
+	}
+	return zone, libdns.RelativeName(fqdn, zone), nil
+}
+
+// rangeCovers reports whether the RFC 2317 zone label, "first-last" or
+// "first/prefixlen", covers the last octet of an address.
+func rangeCovers(label string, octet int) bool {
+	if i := strings.IndexAny(label, "-/"); i > 0 {
+		first, err := strconv.Atoi(label[:i])
+		if err != nil {
+			return false
+		}
+		n, err := strconv.Atoi(label[i+1:])
+		if err != nil {
+			return false
+		}
+		last := n
+		if label[i] == '/' {
+			if n < 24 || n > 32 {
+				return false
+			}
+			last = first + 1<<(32-n) - 1
+		}
+		return octet >= first && octet <= last
+	}
+	return false
+}
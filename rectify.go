@@ -0,0 +1,66 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// zoneSettings holds the zone level properties the provider looks at.
+type zoneSettings struct {
+	Kind       zones.ZoneKind `json:"kind"`
+	Masters    []string       `json:"masters"`
+	DNSSec     bool           `json:"dnssec"`
+	APIRectify bool           `json:"api_rectify"`
+	Presigned  bool           `json:"presigned"`
+}
+
+// APIRectify reports whether the server rectifies zone by itself after every
+// change made through the API.
+func (p *Provider) APIRectify(ctx context.Context, zone string) (bool, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return false, err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return false, err
+	}
+	settings, err := c.zoneSettings(ctx, zID)
+	if err != nil {
+		return false, err
+	}
+	return settings.APIRectify, nil
+}
+
+// SetAPIRectify turns the server's rectification of zone after API changes
+// on or off.
+func (p *Provider) SetAPIRectify(ctx context.Context, zone string, on bool) error {
+	in := struct {
+		APIRectify bool `json:"api_rectify"`
+	}{on}
+	return p.updateZone(ctx, zone, in)
+}
+
+func (c *client) zoneSettings(ctx context.Context, zoneID string) (zoneSettings, error) {
+	var out zoneSettings
+	q := url.Values{"rrsets": {"false"}}
+	err := c.do(ctx, "GET", c.serverPath("zones", zoneID), q, nil, &out)
+	return out, err
+}
+
+// rectifyIfNeeded rectifies the zone if it is DNSSEC signed and the server
+// doesn't do so itself after API changes.
+func (c *client) rectifyIfNeeded(ctx context.Context, zoneID string) error {
+	settings, err := c.zoneSettings(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+	if !settings.DNSSec || settings.APIRectify {
+		return nil
+	}
+	return c.do(ctx, "PUT", c.serverPath("zones", zoneID, "rectify"), nil, nil, nil)
+}
@@ -0,0 +1,71 @@
+package pdnsprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const redacted = "REDACTED"
+
+// String describes the provider with its secrets redacted.
+func (p *Provider) String() string {
+	token := ""
+	if p.APIToken != "" {
+		token = redacted
+	}
+	return fmt.Sprintf("pdnsprovider.Provider{ServerURL: %q, ServerID: %q, APIToken: %q}", p.ServerURL, p.ServerID, token)
+}
+
+// MarshalJSON encodes the provider configuration with its secrets, those
+// of Endpoints included, redacted, so that dumping a loaded configuration
+// doesn't leak them.
+func (p *Provider) MarshalJSON() ([]byte, error) {
+	type plain Provider
+	b, err := json.Marshal((*plain)(p))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	redactFields(fields, "api_token", "tsig_secret")
+	if endpoints, ok := fields["endpoints"].(map[string]interface{}); ok {
+		for _, ep := range endpoints {
+			if ep, ok := ep.(map[string]interface{}); ok {
+				redactFields(ep, "api_token")
+			}
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// redactFields redacts the non-empty values of keys in fields.
+func redactFields(fields map[string]interface{}, keys ...string) {
+	for _, k := range keys {
+		if v, ok := fields[k]; ok && v != "" {
+			fields[k] = redacted
+		}
+	}
+}
+
+// redactWriter replaces secrets in everything written through it.
+type redactWriter struct {
+	w       io.Writer
+	secrets []string
+}
+
+func (r *redactWriter) Write(b []byte) (int, error) {
+	out := b
+	for _, s := range r.secrets {
+		if s != "" {
+			out = bytes.ReplaceAll(out, []byte(s), []byte(redacted))
+		}
+	}
+	if _, err := r.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,48 @@
+package pdnsprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProviderRedaction(t *testing.T) {
+	p := &Provider{
+		ServerURL:  "http://localhost:8081",
+		APIToken:   "hunter2",
+		TSIGSecret: "c2VjcmV0",
+		Endpoints: map[string]Endpoint{
+			"example.net": {ServerURL: "http://pdns2:8081", APIToken: "swordfish"},
+			"example.com": {ServerURL: "http://pdns3:8081"},
+		},
+	}
+
+	for _, s := range []string{p.String(), fmt.Sprintf("%v", p)} {
+		if strings.Contains(s, "hunter2") {
+			t.Errorf("String leaks the token: %s", s)
+		}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("failed to marshal provider: %s", err)
+	}
+	for _, secret := range []string{"hunter2", "c2VjcmV0", "swordfish"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("JSON leaks secrets: %s", b)
+		}
+	}
+	for _, want := range []string{`"server_url":"http://localhost:8081"`, `"server_url":"http://pdns2:8081"`, `"example.com":{"server_url":"http://pdns3:8081"}`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("JSON lost the configuration %s: %s", want, b)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := &redactWriter{w: &buf, secrets: []string{"hunter2"}}
+	fmt.Fprintf(w, "X-Api-Key: hunter2\n")
+	if have, want := buf.String(), "X-Api-Key: REDACTED\n"; have != want {
+		t.Errorf("assertion failed: have: %q want %q", have, want)
+	}
+}
@@ -0,0 +1,86 @@
+package pdnsprovider
+
+import (
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// resultRecords returns the records a mutation reports back to its caller,
+// as they stand on the server: named relative to the zone, with the TTL of
+// the RRset they are in and with their IDs.  before is the zone as read
+// before the change and rRSets the change submitted.  Appended and set
+// records are reported as they are after the change; deleted records as they
+// were before it, and only if they existed.  A deleted record with an empty
+// Value is expanded to the values it removed.  Appended records the zone
+// already had are left out, as are repeats.
+//
+// before may be nil when the zone wasn't read, in which case the records
+// are reported with the TTLs they were given.
+func resultRecords(before *zones.Zone, rRSets []zones.ResourceRecordSet, zone string, records []libdns.Record, op Operation) []libdns.Record {
+	var state, prior map[string]*zones.ResourceRecordSet
+	if before != nil && op == OperationAppend {
+		prior = make(map[string]*zones.ResourceRecordSet, len(before.ResourceRecordSets))
+		for i := range before.ResourceRecordSets {
+			t := &before.ResourceRecordSets[i]
+			prior[key(t.Name, t.Type)] = t
+		}
+	}
+	if before != nil {
+		z := *before
+		if op != OperationDelete {
+			z.ResourceRecordSets = append([]zones.ResourceRecordSet(nil), before.ResourceRecordSets...)
+			applyRRSets(&z, rRSets)
+		}
+		state = make(map[string]*zones.ResourceRecordSet, len(z.ResourceRecordSets))
+		for i := range z.ResourceRecordSets {
+			t := &z.ResourceRecordSets[i]
+			state[key(t.Name, t.Type)] = t
+		}
+	}
+
+	out := make([]libdns.Record, 0, len(records))
+	seen := make(map[string]bool)
+	for _, rec := range convertNamesToAbsolute(zone, records) {
+		k := key(rec.Name, rec.Type)
+		t, found := state[k]
+		if rec.Value == "" {
+			if op == OperationDelete && found {
+				out = appendLDRecords(out, zone, *t)
+			}
+			continue
+		}
+		if op == OperationAppend {
+			if old, ok := prior[k]; (ok && rRSetHasValue(*old, rec.Value)) || seen[k+"|"+rec.Value] {
+				continue
+			}
+			seen[k+"|"+rec.Value] = true
+		}
+		if found {
+			if op == OperationDelete && !rRSetHasValue(*t, rec.Value) {
+				continue
+			}
+			rec.TTL = time.Duration(t.TTL) * time.Second
+		} else if before != nil && op == OperationDelete {
+			continue
+		}
+		rec.ID = recordID(rec.Name, rec.Type, rec.Value)
+		rec.Name = libdns.RelativeName(rec.Name, zone)
+		if hasTXTContent(rec.Type) {
+			rec.Value = joinTXT(rec.Value)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// rRSetHasValue reports whether rRSet contains value.
+func rRSetHasValue(rRSet zones.ResourceRecordSet, value string) bool {
+	for _, r := range rRSet.Records {
+		if r.Content == value {
+			return true
+		}
+	}
+	return false
+}
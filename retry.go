@@ -0,0 +1,211 @@
+package pdnsprovider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorClass is how a RetryPolicy classifies the outcome of a request.
+type ErrorClass int
+
+const (
+	// ErrorNone is a request that succeeded, or failed in a way the
+	// caller should see, such as a 404.
+	ErrorNone ErrorClass = iota
+	// ErrorPermanent is a failure that won't go away by trying again.
+	ErrorPermanent
+	// ErrorTransient is a failure that may succeed when retried, such as
+	// a dropped connection or a 502 from a proxy.
+	ErrorTransient
+	// ErrorThrottled is a request the server or a proxy refused because
+	// of a rate limit.
+	ErrorThrottled
+)
+
+// RetryPolicy decides whether and when failed API requests are retried.
+// Its methods are called concurrently and must not modify the request or
+// response they are given.
+type RetryPolicy interface {
+	// Classify sorts the outcome of an attempt at req into an
+	// ErrorClass.  Exactly one of resp and err is non-nil.
+	Classify(req *http.Request, resp *http.Response, err error) ErrorClass
+
+	// Retry reports whether to make another attempt after retries
+	// attempts have already failed with class.  It is only called for
+	// ErrorTransient and ErrorThrottled.
+	Retry(retries int, class ErrorClass) bool
+
+	// Delay returns how long to wait before the next attempt.  resp is
+	// the failed response, or nil if there was none.
+	Delay(retries int, class ErrorClass, resp *http.Response) time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used when Provider.Retries is set.
+// It retries connection errors and 502, 503 and 504 responses as
+// transient, and 429 responses as throttled, waiting twice as long after
+// each failure and honouring Retry-After headers.  Delays are jittered so
+// that clients sharing a server don't retry in lockstep.  POST requests
+// are only retried when the server answered, since a request that was
+// lost in transit may have been applied.
+type DefaultRetryPolicy struct {
+	// MaxRetries is how many times a request is retried.
+	MaxRetries int
+
+	// BaseDelay is the wait before the first retry, 250ms by default.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the wait before a retry, 10s by default.
+	MaxDelay time.Duration
+
+	// Jitter returns a random duration between 0 and d.  Backoff delays
+	// are replaced with Jitter(delay), and BaseDelay is jittered and
+	// added to the wait a Retry-After header asks for.  It defaults to
+	// a uniform random duration and can be set for deterministic tests.
+	Jitter func(d time.Duration) time.Duration
+}
+
+const (
+	defaultRetryBaseDelay = 250 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// Classify implements RetryPolicy.
+func (d *DefaultRetryPolicy) Classify(req *http.Request, resp *http.Response, err error) ErrorClass {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return ErrorPermanent
+		}
+		if req.Method == http.MethodPost {
+			return ErrorPermanent
+		}
+		return ErrorTransient
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return ErrorThrottled
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrorTransient
+	}
+	return ErrorNone
+}
+
+// Retry implements RetryPolicy.
+func (d *DefaultRetryPolicy) Retry(retries int, class ErrorClass) bool {
+	return retries < d.MaxRetries
+}
+
+// Delay implements RetryPolicy.
+func (d *DefaultRetryPolicy) Delay(retries int, class ErrorClass, resp *http.Response) time.Duration {
+	maxDelay := d.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	base := d.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	jitter := d.Jitter
+	if jitter == nil {
+		jitter = fullJitter
+	}
+	if after, ok := retryAfter(resp); ok {
+		if after > maxDelay {
+			after = maxDelay
+		}
+		return after + jitter(base)
+	}
+	delay := base
+	for i := 0; i < retries && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return jitter(delay)
+}
+
+// fullJitter returns a uniform random duration between 0 and d.
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryAfter returns the wait a response asks for with a Retry-After
+// header, given either in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryTransport retries requests as its policy directs.
+type retryTransport struct {
+	policy RetryPolicy
+	base   http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for retries := 0; ; retries++ {
+		attempt := req
+		if retries > 0 {
+			attempt = req.Clone(req.Context())
+			if req.Body != nil && req.Body != http.NoBody {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attempt.Body = body
+			}
+		}
+		resp, err := base.RoundTrip(attempt)
+		class := t.policy.Classify(req, resp, err)
+		if class != ErrorTransient && class != ErrorThrottled {
+			return resp, err
+		}
+		// the body can't be sent again without GetBody
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+		if !t.policy.Retry(retries, class) {
+			return resp, err
+		}
+		delay := t.policy.Delay(retries, class, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+const (
+	// TransportAPI applies record changes through the HTTP API.
+	TransportAPI = "api"
+	// TransportRFC2136 applies record changes with RFC 2136 dynamic
+	// updates sent to DNSUpdateServer.
+	TransportRFC2136 = "rfc2136"
+)
+
+// dnsUpdate applies op to records with an RFC 2136 dynamic update.
+func (p *Provider) dnsUpdate(ctx context.Context, zone string, op Operation, records []libdns.Record) ([]libdns.Record, error) {
+	if err := p.checkZone(zone); err != nil {
+		return nil, err
+	}
+	if p.ReadOnly {
+		return nil, &ReadOnlyError{Op: "send a DNS update for " + zone}
+	}
+	if p.MaxRecords > 0 && len(records) > p.MaxRecords {
+		return nil, &PolicyError{Zone: zone, Reason: fmt.Sprintf("would update %d records, more than MaxRecords (%d)", len(records), p.MaxRecords)}
+	}
+	if err := p.checkPolicy(zone, updateRRSets(zone, op, records)); err != nil {
+		return nil, err
+	}
+	if p.DNSUpdateServer == "" {
+		return nil, fmt.Errorf("the %s transport requires dns_update_server", TransportRFC2136)
+	}
+	zone = dns.Fqdn(zone)
+	rrs, err := toDNSRRs(zone, records)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(zone)
+	switch op {
+	case OperationAppend:
+		m.Insert(rrs)
+	case OperationSet:
+		// clear each RRset once before inserting the new values;
+		// records without a value only clear their RRset
+		seen := make(map[string]bool)
+		var clear, values []dns.RR
+		for i, rr := range rrs {
+			k := key(rr.Header().Name, dns.TypeToString[rr.Header().Rrtype])
+			if !seen[k] {
+				seen[k] = true
+				clear = append(clear, rr)
+			}
+			if records[i].Value != "" {
+				values = append(values, rr)
+			}
+		}
+		m.RemoveRRset(clear)
+		if len(values) > 0 {
+			m.Insert(values)
+		}
+	case OperationDelete:
+		// records without a value remove their whole RRset
+		var values, rRSets []dns.RR
+		for i, rr := range rrs {
+			if records[i].Value == "" {
+				rRSets = append(rRSets, rr)
+			} else {
+				values = append(values, rr)
+			}
+		}
+		if len(rRSets) > 0 {
+			m.RemoveRRset(rRSets)
+		}
+		if len(values) > 0 {
+			m.Remove(values)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+
+	dc := &dns.Client{Net: "tcp"}
+	if keyName, algorithm := p.tsig(); keyName != "" {
+		dc.TsigSecret = map[string]string{keyName: p.TSIGSecret}
+		m.SetTsig(keyName, algorithm, tsigFudge, time.Now().Unix())
+	}
+	in, _, err := dc.ExchangeContext(ctx, m, p.DNSUpdateServer)
+	if err != nil {
+		return nil, err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("dynamic update of %s failed: %s", zone, dns.RcodeToString[in.Rcode])
+	}
+	return resultRecords(nil, nil, zone, records, op), nil
+}
+
+// updateRRSets describes the RRsets a DNS update of records for op
+// changes, for the policy checks.  The zone isn't read, so deleting values
+// is taken to delete the whole RRset.
+func updateRRSets(zone string, op Operation, records []libdns.Record) []zones.ResourceRecordSet {
+	changeType := zones.ChangeTypeReplace
+	if op == OperationDelete {
+		changeType = zones.ChangeTypeDelete
+	}
+	var rRSets []zones.ResourceRecordSet
+	index := make(map[string]int)
+	for _, rec := range convertNamesToAbsolute(zone, records) {
+		k := key(rec.Name, rec.Type)
+		i, ok := index[k]
+		if !ok {
+			i = len(rRSets)
+			index[k] = i
+			rRSets = append(rRSets, zones.ResourceRecordSet{Name: rec.Name, Type: rec.Type, ChangeType: changeType})
+		}
+		if rec.Value != "" {
+			rRSets[i].Records = append(rRSets[i].Records, zones.Record{Content: rec.Value})
+		}
+	}
+	return rRSets
+}
+
+// toDNSRRs converts records to resource records for zone.
+func toDNSRRs(zone string, records []libdns.Record) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, rec := range convertNamesToAbsolute(zone, records) {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", rec.Name, int(rec.TTL.Seconds()), rec.Type, rec.Value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s record %s: %s", rec.Type, rec.Name, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
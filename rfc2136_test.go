@@ -0,0 +1,144 @@
+package pdnsprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// updateServer accepts every dynamic update sent to it over TCP.
+type updateServer struct {
+	mu      sync.Mutex
+	updates []*dns.Msg
+}
+
+// startUpdateServer starts an updateServer on a local port and returns it
+// along with its address.
+func startUpdateServer(t *testing.T) (*updateServer, string) {
+	t.Helper()
+	us := &updateServer{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{
+		Listener:          l,
+		Handler:           us,
+		NotifyStartedFunc: func() { close(started) },
+		// the default refuses updates
+		MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+	}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return us, l.Addr().String()
+}
+
+func (us *updateServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	us.mu.Lock()
+	us.updates = append(us.updates, req)
+	us.mu.Unlock()
+	m := new(dns.Msg)
+	m.SetReply(req)
+	w.WriteMsg(m)
+}
+
+func (us *updateServer) count() int {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return len(us.updates)
+}
+
+func TestDNSUpdatePolicy(t *testing.T) {
+	us, addr := startUpdateServer(t)
+	p := &Provider{
+		Transport:       TransportRFC2136,
+		DNSUpdateServer: addr,
+		Protected:       []string{"MX @", "A www"},
+	}
+	ctx := context.Background()
+
+	var policyErr *PolicyError
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "A", Value: "192.0.2.9", TTL: time.Hour}}); !errors.As(err, &policyErr) || !strings.Contains(policyErr.Reason, "protected by") {
+		t.Errorf("expected www A to be refused, got %v", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "MX"}}); !errors.As(err, &policyErr) {
+		t.Errorf("expected deleting the apex MX to be refused, got %v", err)
+	}
+	if us.count() != 0 {
+		t.Errorf("expected no updates, got %d", us.count())
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "AAAA", Value: "2001:db8::1", TTL: time.Hour}}); err != nil {
+		t.Errorf("AppendRecords of an unprotected type failed: %s", err)
+	}
+	if us.count() != 1 {
+		t.Errorf("expected one update, got %d", us.count())
+	}
+
+	p.AllowedZones = []string{"example.net"}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "AAAA", Value: "2001:db8::2", TTL: time.Hour}}); !errors.As(err, &policyErr) {
+		t.Errorf("expected a zone outside AllowedZones to be refused, got %v", err)
+	}
+	p.AllowedZones = nil
+	p.ReadOnly = true
+	var readOnlyErr *ReadOnlyError
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{{Name: "www", Type: "AAAA", Value: "2001:db8::2", TTL: time.Hour}}); !errors.As(err, &readOnlyErr) {
+		t.Errorf("expected a read-only error, got %v", err)
+	}
+	if us.count() != 1 {
+		t.Errorf("expected no more updates, got %d", us.count())
+	}
+}
+
+func TestDNSUpdateApexGuard(t *testing.T) {
+	us, addr := startUpdateServer(t)
+	p := &Provider{Transport: TransportRFC2136, DNSUpdateServer: addr}
+	ctx := context.Background()
+
+	for _, table := range []struct {
+		op      func() error
+		comment string
+	}{
+		{func() error {
+			_, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "SOA"}})
+			return err
+		}, "deleting the SOA"},
+		{func() error {
+			_, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{{Name: "@", Type: "NS", Value: "ns1.example.org."}})
+			return err
+		}, "deleting an NS record, which may be the last"},
+		{func() error {
+			_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{{Name: "", Type: "NS"}})
+			return err
+		}, "setting an empty NS RRset"},
+	} {
+		var policyErr *PolicyError
+		if err := table.op(); !errors.As(err, &policyErr) || !strings.Contains(policyErr.Reason, "AllowApexRemoval") {
+			t.Errorf("%s: expected to be refused, got %v", table.comment, err)
+		}
+	}
+	if us.count() != 0 {
+		t.Errorf("expected no updates, got %d", us.count())
+	}
+
+	// replacing the apex NS records keeps the zone servable
+	ns := []libdns.Record{{Name: "@", Type: "NS", Value: "ns3.example.org.", TTL: time.Hour}}
+	if _, err := p.SetRecords(ctx, "example.org.", ns); err != nil {
+		t.Errorf("SetRecords of the NS records failed: %s", err)
+	}
+	p.AllowApexRemoval = true
+	if _, err := p.DeleteRecords(ctx, "example.org.", ns); err != nil {
+		t.Errorf("DeleteRecords with AllowApexRemoval failed: %s", err)
+	}
+	if us.count() != 2 {
+		t.Errorf("expected 2 updates, got %d", us.count())
+	}
+}
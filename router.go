@@ -0,0 +1,160 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+)
+
+// Router sends libdns calls to whichever of several PowerDNS servers hosts
+// the zone, for platforms that spread their zones over clusters or
+// regions.  Where each zone lives is discovered by listing the zones of
+// every backend, and remembered until Refresh is called or a zone is
+// looked up that no backend was known to host.
+//
+// A Router is safe for concurrent use once Backends has been set.
+type Router struct {
+	// Backends are the Providers of the servers, by name.
+	Backends map[string]*Provider
+
+	mu sync.RWMutex
+	// placement maps lowercased zone names with a trailing dot to the
+	// name of the backend hosting them.
+	placement map[string]string
+}
+
+// Backend returns the name and Provider of the backend hosting zone.
+func (r *Router) Backend(ctx context.Context, zone string) (string, *Provider, error) {
+	k := strings.ToLower(strings.TrimSuffix(zone, ".") + ".")
+	r.mu.RLock()
+	name, ok := r.placement[k]
+	r.mu.RUnlock()
+	if !ok {
+		if err := r.Refresh(ctx); err != nil {
+			return "", nil, err
+		}
+		r.mu.RLock()
+		name, ok = r.placement[k]
+		r.mu.RUnlock()
+		if !ok {
+			return "", nil, fmt.Errorf("zone %s is not hosted by any backend", zone)
+		}
+	}
+	return name, r.Backends[name], nil
+}
+
+// Refresh lists the zones of all backends concurrently and replaces the
+// known placement of zones with the result.  It fails if a backend can't
+// be listed, or if a zone is hosted by more than one backend, since calls
+// for it couldn't be routed.
+func (r *Router) Refresh(ctx context.Context) error {
+	type listing struct {
+		backend string
+		zones   []string
+		err     error
+	}
+	names := make([]string, 0, len(r.Backends))
+	for name := range r.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	listings := make([]listing, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			zs, err := r.Backends[name].ListZones(ctx)
+			listings[i] = listing{backend: name, zones: zs, err: err}
+		}(i, name)
+	}
+	wg.Wait()
+
+	placement := make(map[string]string)
+	for _, l := range listings {
+		if l.err != nil {
+			return fmt.Errorf("error listing the zones of backend %s: %s", l.backend, l.err)
+		}
+		for _, z := range l.zones {
+			k := strings.ToLower(strings.TrimSuffix(z, ".") + ".")
+			if other, ok := placement[k]; ok && other != l.backend {
+				return fmt.Errorf("zone %s is hosted by both backend %s and backend %s", z, other, l.backend)
+			}
+			placement[k] = l.backend
+		}
+	}
+	r.mu.Lock()
+	r.placement = placement
+	r.mu.Unlock()
+	return nil
+}
+
+// ListZones returns the names of the zones of all backends, as of the last
+// Refresh, listing them first if they haven't been.
+func (r *Router) ListZones(ctx context.Context) ([]string, error) {
+	r.mu.RLock()
+	known := r.placement != nil
+	r.mu.RUnlock()
+	if !known {
+		if err := r.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.placement))
+	for z := range r.placement {
+		out = append(out, z)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// GetRecords lists the records of zone on the backend hosting it.
+func (r *Router) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	_, p, err := r.Backend(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return p.GetRecords(ctx, zone)
+}
+
+// AppendRecords adds records to zone on the backend hosting it.
+func (r *Router) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	_, p, err := r.Backend(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return p.AppendRecords(ctx, zone, records)
+}
+
+// SetRecords sets records in zone on the backend hosting it.
+func (r *Router) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	_, p, err := r.Backend(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return p.SetRecords(ctx, zone, records)
+}
+
+// DeleteRecords deletes records from zone on the backend hosting it.
+func (r *Router) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	_, p, err := r.Backend(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return p.DeleteRecords(ctx, zone, records)
+}
+
+// Interface guards
+var (
+	_ libdns.RecordGetter   = (*Router)(nil)
+	_ libdns.RecordAppender = (*Router)(nil)
+	_ libdns.RecordSetter   = (*Router)(nil)
+	_ libdns.RecordDeleter  = (*Router)(nil)
+)
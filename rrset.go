@@ -0,0 +1,111 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// DeleteRRset deletes the RRset of name and rrType from the zone with a
+// single patch, without reading the zone first.  name is relative to the
+// zone, "" or "@" for the apex.  Deleting an RRset that doesn't exist
+// succeeds.  When Owner is set the RRset is still read so that ownership
+// can be checked.  The change always goes through the API.
+func (p *Provider) DeleteRRset(ctx context.Context, zone, name, rrType string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	if name == "@" {
+		name = ""
+	}
+	abs := convertNamesToAbsolute(zone, []libdns.Record{{Name: name, Type: strings.ToUpper(rrType)}})
+	rRSets := []zones.ResourceRecordSet{{
+		Name:       abs[0].Name,
+		Type:       abs[0].Type,
+		ChangeType: zones.ChangeTypeDelete,
+	}}
+
+	var zoneID string
+	if p.Owner != "" {
+		fullZone, err := c.partialZone(ctx, zone, abs)
+		if err != nil {
+			return err
+		}
+		if err := p.checkOwnership(fullZone, rRSets); err != nil {
+			return err
+		}
+		zoneID = fullZone.ID
+	} else {
+		zoneID, err = c.zoneID(ctx, zone)
+		if err != nil {
+			return err
+		}
+	}
+	return p.updateRRs(ctx, c, zone, zoneID, rRSets)
+}
+
+// PatchRRsets submits rRSets to the zone as they are, for changes the
+// record level methods can't express, such as setting comments or
+// disabling individual records.  RRset names must be fully qualified and
+// within the zone, and every RRset needs a change type.  Owner and Comment
+// are honoured: when either is set the RRsets are read first, so that
+// ownership can be checked and the comments attached.  The follow up
+// actions of other mutations, such as FlushCache, are run as well.
+func (p *Provider) PatchRRsets(ctx context.Context, zone string, rRSets []zones.ResourceRecordSet) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	if len(rRSets) == 0 {
+		return nil
+	}
+	suffix := strings.ToLower(strings.TrimSuffix(zone, ".") + ".")
+	names := make([]libdns.Record, 0, len(rRSets))
+	for _, rr := range rRSets {
+		name := strings.ToLower(rr.Name)
+		if !strings.HasSuffix(name, ".") {
+			return fmt.Errorf("RRset name %s is not fully qualified", rr.Name)
+		}
+		if name != suffix && !strings.HasSuffix(name, "."+suffix) {
+			return fmt.Errorf("RRset %s is not in zone %s", rr.Name, zone)
+		}
+		if rr.Type == "" {
+			return fmt.Errorf("RRset %s has no type", rr.Name)
+		}
+		if rr.ChangeType != zones.ChangeTypeReplace && rr.ChangeType != zones.ChangeTypeDelete {
+			return fmt.Errorf("RRset %s %s has invalid change type %d", rr.Name, rr.Type, rr.ChangeType)
+		}
+		names = append(names, libdns.Record{Name: rr.Name, Type: rr.Type})
+	}
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	if p.Owner == "" && p.Comment == "" {
+		zoneID, err := c.zoneID(ctx, zone)
+		if err != nil {
+			return err
+		}
+		return p.updateRRs(ctx, c, zone, zoneID, rRSets)
+	}
+
+	fullZone, err := c.partialZone(ctx, zone, names)
+	if err != nil {
+		return err
+	}
+	if err := p.checkOwnership(fullZone, rRSets); err != nil {
+		return err
+	}
+	// annotate fills in comments, which mustn't show through to the caller
+	rRSets = append([]zones.ResourceRecordSet(nil), rRSets...)
+	p.annotate(fullZone, rRSets)
+	return p.updateRRs(ctx, c, zone, fullZone.ID, rRSets)
+}
@@ -0,0 +1,60 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// SearchObjectType restricts what kind of objects SearchData returns.
+type SearchObjectType string
+
+const (
+	SearchAll     SearchObjectType = "all"
+	SearchZone    SearchObjectType = "zone"
+	SearchRecord  SearchObjectType = "record"
+	SearchComment SearchObjectType = "comment"
+)
+
+// SearchResult is a single match returned by the search-data endpoint.  Which
+// fields are set depends on ObjectType.
+type SearchResult struct {
+	ObjectType SearchObjectType `json:"object_type"`
+	Name       string           `json:"name"`
+	Zone       string           `json:"zone,omitempty"`
+	ZoneID     string           `json:"zone_id,omitempty"`
+	Type       string           `json:"type,omitempty"`
+	TTL        int              `json:"ttl,omitempty"`
+	Content    string           `json:"content,omitempty"`
+	Disabled   bool             `json:"disabled,omitempty"`
+}
+
+// SearchData searches records, zones and comments across all zones on the
+// server.  query may use * and ? as wildcards.  max limits the number of
+// results, 0 leaves the server default in place.  An empty objectType
+// searches everything.
+func (p *Provider) SearchData(ctx context.Context, query string, max int, objectType SearchObjectType) ([]SearchResult, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.searchData(ctx, query, max, objectType)
+}
+
+func (c *client) searchData(ctx context.Context, query string, max int, objectType SearchObjectType) ([]SearchResult, error) {
+	q := url.Values{"q": {query}}
+	if max > 0 {
+		q.Set("max", strconv.Itoa(max))
+	}
+	if objectType != "" {
+		q.Set("object_type", string(objectType))
+	}
+	var results []SearchResult
+	err := c.do(ctx, "GET", c.serverPath("search-data"), q, nil, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,182 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SecondaryStatus reports the state of a zone on one secondary server.
+type SecondaryStatus struct {
+	// Server is the host:port that was queried.
+	Server string
+
+	// Serial is the SOA serial the server serves.
+	Serial uint32
+
+	// Err is the error querying the server, if any.
+	Err error
+}
+
+// InSync reports whether the secondary serves serial or a newer one.
+func (s SecondaryStatus) InSync(serial uint32) bool {
+	return s.Err == nil && int32(s.Serial-serial) >= 0
+}
+
+// Behind returns how many serial increments the secondary is behind serial,
+// or zero if it is in sync.
+func (s SecondaryStatus) Behind(serial uint32) uint32 {
+	if s.InSync(serial) || s.Err != nil {
+		return 0
+	}
+	return serial - s.Serial
+}
+
+// Freshness compares the serial of a zone in the API with the serials its
+// nameservers serve.
+type Freshness struct {
+	Zone string
+
+	// Serial is the serial the API reports, after SOA-EDIT.
+	Serial uint32
+
+	// Servers holds the state of the zone on each nameserver address.
+	Servers []SecondaryStatus
+}
+
+// Stale returns the servers that serve an older serial or couldn't be
+// queried.
+func (f *Freshness) Stale() []SecondaryStatus {
+	var out []SecondaryStatus
+	for _, s := range f.Servers {
+		if !s.InSync(f.Serial) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// CheckFreshness queries the SOA of zone on all the addresses of its NS
+// records once, and reports how their serials compare to the one the API
+// reports, so that broken replication can be detected.
+func (p *Provider) CheckFreshness(ctx context.Context, zone string) (*Freshness, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := c.nameserverAddrs(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return &Freshness{
+		Zone:    info.Name,
+		Serial:  info.servedSerial(),
+		Servers: querySerials(ctx, servers, zone),
+	}, nil
+}
+
+// Notify asks the server to send NOTIFY messages for zone to its
+// secondaries.
+func (p *Provider) Notify(ctx context.Context, zone string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "PUT", c.serverPath("zones", zID, "notify"), nil, nil, nil)
+}
+
+// WaitForSecondaries polls the SOA of zone on each of Secondaries, or on
+// the zone's nameservers if that is unset, until all of them serve the
+// serial the API reports, or until timeout elapses.  The edited serial is
+// waited for when SOA-EDIT produces one.  A timeout of 0 relies solely on
+// ctx for cancellation.  The last status of every secondary is returned,
+// along with an error naming the ones that still lag.
+func (p *Provider) WaitForSecondaries(ctx context.Context, zone string, timeout time.Duration) ([]SecondaryStatus, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	serial := info.servedSerial()
+	servers := p.Secondaries
+	if len(servers) == 0 {
+		servers, err = c.nameserverAddrs(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ticker := time.NewTicker(propagationInterval)
+	defer ticker.Stop()
+	for {
+		statuses := querySerials(ctx, servers, zone)
+		var lagging []string
+		for _, s := range statuses {
+			if !s.InSync(serial) {
+				lagging = append(lagging, s.Server)
+			}
+		}
+		if len(lagging) == 0 {
+			return statuses, nil
+		}
+		select {
+		case <-ctx.Done():
+			return statuses, fmt.Errorf("secondaries not at serial %d: %s: %s", serial, strings.Join(lagging, ", "), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// servedSerial returns the serial nameservers serve for the zone: the
+// edited serial when SOA-EDIT produces one, and the stored serial otherwise.
+func (i *ZoneInfo) servedSerial() uint32 {
+	if i.EditedSerial != 0 {
+		return i.EditedSerial
+	}
+	return i.Serial
+}
+
+// querySerials asks each of servers for the SOA serial of zone.
+func querySerials(ctx context.Context, servers []string, zone string) []SecondaryStatus {
+	zone = strings.TrimSuffix(zone, ".") + "."
+	statuses := make([]SecondaryStatus, len(servers))
+	for i, server := range servers {
+		statuses[i].Server = server
+		values, err := queryValues(ctx, server, zone, "SOA", false)
+		if err == nil && len(values) == 0 {
+			err = fmt.Errorf("no SOA for %s", zone)
+		}
+		if err != nil {
+			statuses[i].Err = err
+			continue
+		}
+		soa, err := ParseSOA(values[0])
+		if err != nil {
+			statuses[i].Err = err
+			continue
+		}
+		statuses[i].Serial = soa.Serial
+	}
+	return statuses
+}
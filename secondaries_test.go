@@ -0,0 +1,32 @@
+package pdnsprovider
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFreshnessStale(t *testing.T) {
+	f := &Freshness{
+		Zone:   "example.org.",
+		Serial: 5,
+		Servers: []SecondaryStatus{
+			{Server: "192.0.2.1:53", Serial: 5},
+			{Server: "192.0.2.2:53", Serial: 3},
+			{Server: "192.0.2.3:53", Err: errors.New("timeout")},
+			{Server: "192.0.2.4:53", Serial: 6},
+		},
+	}
+	stale := f.Stale()
+	if len(stale) != 2 || stale[0].Server != "192.0.2.2:53" || stale[1].Server != "192.0.2.3:53" {
+		t.Errorf("unexpected stale servers %#v", stale)
+	}
+	if n := stale[0].Behind(f.Serial); n != 2 {
+		t.Errorf("expected 2 serials behind, got %d", n)
+	}
+
+	// serials compare in serial number arithmetic
+	wrapped := SecondaryStatus{Serial: 1}
+	if !wrapped.InSync(0xffffffff) {
+		t.Errorf("expected serial 1 to be newer than 0xffffffff")
+	}
+}
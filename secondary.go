@@ -0,0 +1,105 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// CreateSecondaryZone creates zone as a secondary (Slave) zone that is
+// transferred from masters.  Each master is an IP address, optionally with
+// a port.
+func (p *Provider) CreateSecondaryZone(ctx context.Context, zone string, masters []string) error {
+	if err := validateMasters(masters); err != nil {
+		return err
+	}
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	in := struct {
+		Name    string         `json:"name"`
+		Kind    zones.ZoneKind `json:"kind"`
+		Masters []string       `json:"masters"`
+	}{strings.TrimSuffix(zone, ".") + ".", zones.ZoneKindSlave, masters}
+	if err := c.do(ctx, "POST", c.serverPath("zones"), nil, in, nil); err != nil {
+		return err
+	}
+	c.missing.forget(in.Name)
+	return nil
+}
+
+// MakeSecondary converts an existing zone into a secondary zone that is
+// transferred from masters.
+func (p *Provider) MakeSecondary(ctx context.Context, zone string, masters []string) error {
+	if err := validateMasters(masters); err != nil {
+		return err
+	}
+	in := struct {
+		Kind    zones.ZoneKind `json:"kind"`
+		Masters []string       `json:"masters"`
+	}{zones.ZoneKindSlave, masters}
+	return p.updateZone(ctx, zone, in)
+}
+
+// Masters returns the primary servers a secondary zone is transferred from.
+func (p *Provider) Masters(ctx context.Context, zone string) ([]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := c.zoneSettings(ctx, zID)
+	if err != nil {
+		return nil, err
+	}
+	return settings.Masters, nil
+}
+
+// SetMasters replaces the primary servers a secondary zone is transferred
+// from.
+func (p *Provider) SetMasters(ctx context.Context, zone string, masters []string) error {
+	if err := validateMasters(masters); err != nil {
+		return err
+	}
+	in := struct {
+		Masters []string `json:"masters"`
+	}{masters}
+	return p.updateZone(ctx, zone, in)
+}
+
+// updateZone changes the zone level properties in `in`.
+func (p *Provider) updateZone(ctx context.Context, zone string, in interface{}) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	zID, err := c.zoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "PUT", c.serverPath("zones", zID), nil, in, nil)
+}
+
+func validateMasters(masters []string) error {
+	if len(masters) == 0 {
+		return fmt.Errorf("a secondary zone needs at least one master")
+	}
+	for _, m := range masters {
+		if err := validateAddr(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+)
+
+// Server describes a server managed through the API.
+type Server struct {
+	ID         string `json:"id"`
+	DaemonType string `json:"daemon_type"`
+	Version    string `json:"version"`
+	URL        string `json:"url"`
+}
+
+// ListServers returns the servers the API manages, whose IDs are the valid
+// values of ServerID.
+func (p *Provider) ListServers(ctx context.Context) ([]Server, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	var out []Server
+	if err := c.do(ctx, "GET", "/servers", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CheckServerID returns an error if the configured ServerID isn't one of
+// the servers the API manages.
+func (p *Provider) CheckServerID(ctx context.Context) error {
+	servers, err := p.ListServers(ctx)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(servers))
+	for _, s := range servers {
+		if s.ID == p.ServerID {
+			return nil
+		}
+		ids = append(ids, s.ID)
+	}
+	return fmt.Errorf("server %q not found, the API has %q", p.ServerID, ids)
+}
+
+// ServerConfig returns the configuration settings of the server, such as
+// "default-soa-content" or "api-readonly", by name.
+func (p *Provider) ServerConfig(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.serverConfig(ctx)
+}
+
+func (c *client) serverConfig(ctx context.Context) (map[string]string, error) {
+	var settings []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	if err := c.do(ctx, "GET", c.serverPath("config"), nil, nil, &settings); err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(settings))
+	for _, s := range settings {
+		out[s.Name] = s.Value
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package pdnsprovider
+
+import (
+	"context"
+	"time"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ZoneSnapshot is a serializable copy of all RRsets in a zone.
+type ZoneSnapshot struct {
+	Zone   string                    `json:"zone"`
+	Serial int                       `json:"serial"`
+	Taken  time.Time                 `json:"taken"`
+	RRSets []zones.ResourceRecordSet `json:"rrsets"`
+}
+
+// SnapshotZone captures the current RRsets of zone.  The snapshot is the
+// caller's to modify.
+func (p *Provider) SnapshotZone(ctx context.Context, zone string) (*ZoneSnapshot, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	fullZone, err := c.fullZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	return &ZoneSnapshot{
+		Zone:   zone,
+		Serial: fullZone.Serial,
+		Taken:  time.Now(),
+		RRSets: copyRRSets(fullZone.ResourceRecordSets),
+	}, nil
+}
+
+// copyRRSets returns a deep copy of rRSets, which may be shared with the
+// zone cache.
+func copyRRSets(rRSets []zones.ResourceRecordSet) []zones.ResourceRecordSet {
+	out := make([]zones.ResourceRecordSet, len(rRSets))
+	for i, rr := range rRSets {
+		if rr.Records != nil {
+			rr.Records = append(make([]zones.Record, 0, len(rr.Records)), rr.Records...)
+		}
+		if rr.Comments != nil {
+			rr.Comments = append(make([]zones.Comment, 0, len(rr.Comments)), rr.Comments...)
+		}
+		out[i] = rr
+	}
+	return out
+}
+
+// RestoreZone puts the zone back into the state captured by snap.  RRsets
+// created since the snapshot are deleted and those changed since are
+// replaced with their snapshotted contents.  The SOA is left alone so that
+// the serial keeps moving forward.  With Owner set, the restore fails if
+// it would change an RRset owned by someone else.
+func (p *Provider) RestoreZone(ctx context.Context, snap *ZoneSnapshot) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	defer p.lockZone(snap.Zone)()
+
+	c, err := p.clientFor(snap.Zone)
+	if err != nil {
+		return err
+	}
+	fullZone, err := c.fullZone(ctx, snap.Zone)
+	if err != nil {
+		return err
+	}
+	rRSets := restoreRRSets(fullZone, snap)
+	if len(rRSets) == 0 {
+		return nil
+	}
+	if err := p.checkOwnership(fullZone, rRSets); err != nil {
+		return err
+	}
+	return p.updateRRs(ctx, c, snap.Zone, fullZone.ID, rRSets)
+}
+
+// restoreRRSets computes the changes that turn fullZone back into snap.
+func restoreRRSets(fullZone *zones.Zone, snap *ZoneSnapshot) []zones.ResourceRecordSet {
+	current := make(map[string]*zones.ResourceRecordSet, len(fullZone.ResourceRecordSets))
+	for i := range fullZone.ResourceRecordSets {
+		t := &fullZone.ResourceRecordSets[i]
+		current[key(t.Name, t.Type)] = t
+	}
+	keep := make(map[string]bool, len(snap.RRSets))
+	var rRSets []zones.ResourceRecordSet
+	for _, rr := range snap.RRSets {
+		if rr.Type == "SOA" {
+			continue
+		}
+		k := key(rr.Name, rr.Type)
+		keep[k] = true
+		if t, ok := current[k]; ok && sameValues(*t, rr) && sameComments(t.Comments, rr.Comments) {
+			continue
+		}
+		rr.ChangeType = zones.ChangeTypeReplace
+		rRSets = append(rRSets, rr)
+	}
+	for _, rr := range fullZone.ResourceRecordSets {
+		if rr.Type == "SOA" || keep[key(rr.Name, rr.Type)] {
+			continue
+		}
+		rRSets = append(rRSets, zones.ResourceRecordSet{
+			Name:       rr.Name,
+			Type:       rr.Type,
+			ChangeType: zones.ChangeTypeDelete,
+		})
+	}
+	return rRSets
+}
+
+// sameComments reports whether a and b hold the same comments in the same
+// order.
+func sameComments(a, b []zones.Comment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// SOA holds the fields of a zone's SOA record.
+type SOA struct {
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+}
+
+// ParseSOA parses the content of an SOA record.
+func ParseSOA(content string) (SOA, error) {
+	fields := strings.Fields(content)
+	if len(fields) != 7 {
+		return SOA{}, fmt.Errorf("invalid SOA content %q", content)
+	}
+	soa := SOA{MName: fields[0], RName: fields[1]}
+	for i, v := range []*uint32{&soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.Minimum} {
+		n, err := strconv.ParseUint(fields[i+2], 10, 32)
+		if err != nil {
+			return SOA{}, fmt.Errorf("invalid SOA content %q: %s", content, err)
+		}
+		*v = uint32(n)
+	}
+	return soa, nil
+}
+
+// String returns the SOA as record content.
+func (s SOA) String() string {
+	return fmt.Sprintf("%s %s %d %d %d %d %d", s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
+}
+
+// GetSOA returns the SOA of the zone.
+func (p *Provider) GetSOA(ctx context.Context, zone string) (SOA, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return SOA{}, err
+	}
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, []libdns.Record{{Type: "SOA"}}))
+	if err != nil {
+		return SOA{}, err
+	}
+	rr, err := findSOA(fullZone)
+	if err != nil {
+		return SOA{}, err
+	}
+	return ParseSOA(rr.Records[0].Content)
+}
+
+// UpdateSOA changes the SOA of the zone with fn, which is passed the current
+// SOA.  If fn leaves the serial alone it is incremented, so that secondaries
+// pick up the change; a serial that fn sets lower than the current one is
+// rejected.  The updated SOA is returned.
+func (p *Provider) UpdateSOA(ctx context.Context, zone string, fn func(*SOA)) (SOA, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return SOA{}, err
+	}
+	rec := libdns.Record{Type: "SOA"}
+	fullZone, err := c.partialZone(ctx, zone, convertNamesToAbsolute(zone, []libdns.Record{rec}))
+	if err != nil {
+		return SOA{}, err
+	}
+	rr, err := findSOA(fullZone)
+	if err != nil {
+		return SOA{}, err
+	}
+	soa, err := ParseSOA(rr.Records[0].Content)
+	if err != nil {
+		return SOA{}, err
+	}
+	updated := soa
+	fn(&updated)
+	if updated.Serial == soa.Serial {
+		updated.Serial++
+	}
+	rec.Value = updated.String()
+	rec.TTL = time.Duration(rr.TTL) * time.Second
+	rRSets, err := p.buildChanges(fullZone, zone, []libdns.Record{rec}, OperationSet)
+	if err != nil {
+		return SOA{}, err
+	}
+	if err := p.updateRRs(ctx, c, zone, fullZone.ID, rRSets); err != nil {
+		return SOA{}, err
+	}
+	return updated, nil
+}
+
+func findSOA(fullZone *zones.Zone) (*zones.ResourceRecordSet, error) {
+	for i, rr := range fullZone.ResourceRecordSets {
+		if rr.Type == "SOA" && len(rr.Records) > 0 {
+			return &fullZone.ResourceRecordSets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("zone %s has no SOA record", fullZone.Name)
+}
+
+// checkSerial rejects changes that would move the serial of the zone's SOA
+// backwards, in serial number arithmetic, which would keep secondaries from
+// picking up changes.
+func checkSerial(fullZone *zones.Zone, rRSets []zones.ResourceRecordSet) error {
+	if fullZone == nil {
+		return nil
+	}
+	for _, rr := range rRSets {
+		if rr.Type != "SOA" || rr.ChangeType == zones.ChangeTypeDelete || len(rr.Records) == 0 {
+			continue
+		}
+		current, err := findSOA(fullZone)
+		if err != nil {
+			return nil
+		}
+		old, err := ParseSOA(current.Records[0].Content)
+		if err != nil {
+			return err
+		}
+		updated, err := ParseSOA(rr.Records[0].Content)
+		if err != nil {
+			return err
+		}
+		if int32(updated.Serial-old.Serial) < 0 {
+			return fmt.Errorf("SOA serial of %s would go back from %d to %d", fullZone.Name, old.Serial, updated.Serial)
+		}
+	}
+	return nil
+}
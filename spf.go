@@ -0,0 +1,55 @@
+package pdnsprovider
+
+import (
+	"log"
+
+	"github.com/libdns/libdns"
+)
+
+// mirrorSPF warns about records of the SPF type being written, which RFC
+// 7208 retired in favour of TXT records and resolvers no longer look up,
+// and with MirrorSPF set adds a TXT record with the same name and value for
+// each of them that has a value.  Deleting SPF records draws no warning.
+func (p *Provider) mirrorSPF(records []libdns.Record, op Operation) []libdns.Record {
+	var spf []libdns.Record
+	for _, rec := range records {
+		if rec.Type == "SPF" {
+			spf = append(spf, rec)
+		}
+	}
+	if len(spf) == 0 {
+		return records
+	}
+	if op != OperationDelete {
+		p.warnf("%s: the SPF record type is obsolete and ignored by resolvers, publish SPF policies as TXT records", spf[0].Name)
+	}
+	if !p.MirrorSPF {
+		return records
+	}
+	have := make(map[libdns.Record]bool, len(records))
+	for _, rec := range records {
+		have[rec] = true
+	}
+	out := append([]libdns.Record(nil), records...)
+	for _, rec := range spf {
+		// clearing the SPF RRset mustn't clear unrelated TXT records
+		if rec.Value == "" {
+			continue
+		}
+		rec.Type = "TXT"
+		if !have[rec] {
+			have[rec] = true
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+// warnf reports a problem that doesn't stop an operation.
+func (p *Provider) warnf(format string, args ...interface{}) {
+	if p.Warnf != nil {
+		p.Warnf(format, args...)
+		return
+	}
+	log.Printf("pdnsprovider: "+format, args...)
+}
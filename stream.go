@@ -0,0 +1,162 @@
+package pdnsprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ForEachRecord calls fn for every record in the zone.  The zone is decoded
+// one RRset at a time as it arrives from the server, so the whole zone is
+// never held in memory.  Iteration stops at the first error fn returns,
+// which ForEachRecord then returns.
+func (p *Provider) ForEachRecord(ctx context.Context, zone string, fn func(libdns.Record) error) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	if p.OmitSOAAndNS {
+		inner := fn
+		fn = func(rec libdns.Record) error {
+			if isApexRecord(rec) {
+				return nil
+			}
+			return inner(rec)
+		}
+	}
+	if p.AXFRServer != "" || p.Transport == TransportRFC2136 {
+		return p.transferRecords(ctx, zone, fn)
+	}
+	var recs []libdns.Record
+	return p.forEachRRSet(ctx, zone, func(rRSet zones.ResourceRecordSet) error {
+		recs = appendLDRecords(recs[:0], zone, rRSet)
+		for _, rec := range recs {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// forEachRRSet calls fn for every RRset in the zone, as read through the
+// API.  Complete reads are counted in the zone's stats.
+func (p *Provider) forEachRRSet(ctx context.Context, zone string, fn func(zones.ResourceRecordSet) error) error {
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	rRSets, records := 0, 0
+	count := func(rRSet zones.ResourceRecordSet) error {
+		rRSets++
+		records += len(rRSet.Records)
+		return fn(rRSet)
+	}
+	if !c.direct || c.zoneCache != nil {
+		// other zone clients can only hand back whole zones, and the
+		// cache keeps them whole
+		fullZone, err := c.fullZone(ctx, zone)
+		if err != nil {
+			return err
+		}
+		for _, rRSet := range fullZone.ResourceRecordSets {
+			if err := count(rRSet); err != nil {
+				return err
+			}
+		}
+		p.countFetch(zone, rRSets, records, 0)
+		return nil
+	}
+	shortZone, err := c.healthyZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	n, err := c.streamRRSets(ctx, shortZone.ID, count)
+	if err != nil {
+		return err
+	}
+	p.countFetch(zone, rRSets, records, n)
+	return nil
+}
+
+// isApexRecord reports whether rec is the SOA or one of the apex NS records.
+func isApexRecord(rec libdns.Record) bool {
+	switch rec.Type {
+	case "SOA":
+		return true
+	case "NS":
+		return rec.Name == "" || rec.Name == "@"
+	}
+	return false
+}
+
+// streamRRSets fetches the zone and calls fn for each RRset as it is decoded
+// from the response.  It returns the number of bytes read.
+func (c *client) streamRRSets(ctx context.Context, zoneID string, fn func(zones.ResourceRecordSet) error) (int64, error) {
+	resp, err := c.request(ctx, "GET", c.serverPath("zones", zoneID), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body := &countingReader{r: resp.Body}
+	err = decodeRRSets(body, fn)
+	return body.n, err
+}
+
+// decodeRRSets reads a JSON zone from r and calls fn for each of its RRsets.
+// The RRset passed to fn shares its slices with the decode buffer, and is
+// only valid until fn returns.
+func decodeRRSets(r io.Reader, fn func(zones.ResourceRecordSet) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	var rRSet zones.ResourceRecordSet
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != "rrsets" {
+			// skip over zone level fields
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			// reuse the record and comment buffers between RRsets
+			rRSet = zones.ResourceRecordSet{
+				Records:  rRSet.Records[:0],
+				Comments: rRSet.Comments[:0],
+			}
+			if err := dec.Decode(&rRSet); err != nil {
+				return err
+			}
+			if err := fn(rRSet); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("unexpected token %v in zone data, want %v", tok, want)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// tokenTransport sets the API key of each request from a token source.
+type tokenTransport struct {
+	source func(ctx context.Context) (string, error)
+	base   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("error getting API token: %s", err)
+	}
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("X-API-Key", token)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,104 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultAPIPath is where the API lives below the server URL, and the path
+// go-powerdns always uses.
+const defaultAPIPath = "/api/v1"
+
+// buildTransport builds the round tripper for requests to serverURL, along
+// with its circuit breaker if there is one.
+func (p *Provider) buildTransport(serverURL string, tokenSource func(ctx context.Context) (string, error)) (http.RoundTripper, *circuitBreaker) {
+	rt := p.HTTPTransport
+	if rt == nil && (p.MaxIdleConnsPerHost != 0 || p.IdleConnTimeout != 0 || p.DisableKeepAlives || p.DialContext != nil || p.Resolver != nil) {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		switch {
+		case p.DialContext != nil:
+			t.DialContext = p.DialContext
+		case p.Resolver != nil:
+			// the settings of http.DefaultTransport's dialer
+			d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: p.Resolver}
+			t.DialContext = d.DialContext
+		}
+		if p.MaxIdleConnsPerHost != 0 {
+			t.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+			if t.MaxIdleConns < p.MaxIdleConnsPerHost {
+				t.MaxIdleConns = p.MaxIdleConnsPerHost
+			}
+		}
+		if p.IdleConnTimeout != 0 {
+			t.IdleConnTimeout = p.IdleConnTimeout
+		}
+		t.DisableKeepAlives = p.DisableKeepAlives
+		rt = t
+	}
+	if apiPath := p.apiPath(); apiPath != defaultAPIPath {
+		base := ""
+		if serverURL, err := normalizeServerURL(serverURL, apiPath); err == nil {
+			if u, err := url.Parse(serverURL); err == nil {
+				base = u.Path
+			}
+		}
+		rt = &pathTransport{from: base + defaultAPIPath, to: base + apiPath, base: rt}
+	}
+	if tokenSource != nil {
+		rt = &tokenTransport{source: tokenSource, base: rt}
+	}
+	if policy := p.retryPolicy(); policy != nil {
+		rt = &retryTransport{policy: policy, base: rt}
+	}
+	var b *circuitBreaker
+	if p.BreakerThreshold > 0 {
+		b = newCircuitBreaker(p.BreakerThreshold, p.BreakerCooldown)
+		rt = &breakerTransport{breaker: b, base: rt}
+	}
+	return rt, b
+}
+
+// apiPath returns the path below ServerURL the API is served at.
+func (p *Provider) apiPath() string {
+	if p.APIPath == "" {
+		return defaultAPIPath
+	}
+	return "/" + strings.Trim(p.APIPath, "/")
+}
+
+// retryPolicy returns the policy API requests are retried with, or nil
+// when they aren't retried.
+func (p *Provider) retryPolicy() RetryPolicy {
+	if p.RetryPolicy != nil {
+		return p.RetryPolicy
+	}
+	if p.Retries > 0 {
+		return &DefaultRetryPolicy{MaxRetries: p.Retries}
+	}
+	return nil
+}
+
+// pathTransport moves requests from one API path prefix to another.
+type pathTransport struct {
+	from, to string
+	base     http.RoundTripper
+}
+
+func (t *pathTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, t.from) {
+		req = req.Clone(req.Context())
+		req.URL.Path = t.to + strings.TrimPrefix(req.URL.Path, t.from)
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = t.to + strings.TrimPrefix(req.URL.RawPath, t.from)
+		}
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,232 @@
+package pdnsprovider
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProviderTransport(t *testing.T) {
+	if rt := (&Provider{}).testTransport(); rt != nil {
+		t.Errorf("expected the default transport, got %#v", rt)
+	}
+
+	p := &Provider{MaxIdleConnsPerHost: 64, IdleConnTimeout: time.Minute, DisableKeepAlives: true}
+	tr, ok := p.testTransport().(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport, got %#v", p.testTransport())
+	}
+	if tr.MaxIdleConnsPerHost != 64 || tr.IdleConnTimeout != time.Minute || !tr.DisableKeepAlives {
+		t.Errorf("transport settings were not applied: %d %s %t", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout, tr.DisableKeepAlives)
+	}
+	if tr == http.DefaultTransport {
+		t.Errorf("the default transport was modified")
+	}
+
+	p.APIPath = "/dns"
+	pt, ok := p.testTransport().(*pathTransport)
+	if !ok {
+		t.Fatalf("expected a *pathTransport, got %#v", p.testTransport())
+	}
+	if bt, _ := pt.base.(*http.Transport); bt == nil || bt.MaxIdleConnsPerHost != 64 {
+		t.Errorf("path rewriting does not use the tuned transport: %#v", pt.base)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "payload" {
+			t.Errorf("attempt %d got body %q", atomic.LoadInt32(&attempts), b)
+		}
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	p := &Provider{RetryPolicy: &DefaultRetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond}}
+	hc := &http.Client{Transport: p.testTransport()}
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL, strings.NewReader("payload"))
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || attempts != 3 {
+		t.Errorf("got %s after %d attempts, expected 204 after 3", resp.Status, attempts)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	p.RetryPolicy = &DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}
+	req, _ = http.NewRequest(http.MethodPatch, srv.URL, strings.NewReader("payload"))
+	resp, err = (&http.Client{Transport: p.testTransport()}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || attempts != 2 {
+		t.Errorf("got %s after %d attempts, expected 429 after 2", resp.Status, attempts)
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	d := &DefaultRetryPolicy{MaxRetries: 3, Jitter: func(d time.Duration) time.Duration { return d }}
+	post, _ := http.NewRequest(http.MethodPost, "http://pdns/", nil)
+	get, _ := http.NewRequest(http.MethodGet, "http://pdns/", nil)
+	lost := errors.New("connection reset")
+	for _, tc := range []struct {
+		req    *http.Request
+		status int
+		err    error
+		want   ErrorClass
+	}{
+		{get, 0, lost, ErrorTransient},
+		{post, 0, lost, ErrorPermanent},
+		{get, 0, context.Canceled, ErrorPermanent},
+		{post, http.StatusServiceUnavailable, nil, ErrorTransient},
+		{get, http.StatusTooManyRequests, nil, ErrorThrottled},
+		{get, http.StatusNotFound, nil, ErrorNone},
+		{get, http.StatusOK, nil, ErrorNone},
+	} {
+		var resp *http.Response
+		if tc.err == nil {
+			resp = &http.Response{StatusCode: tc.status, Header: http.Header{}}
+		}
+		if got := d.Classify(tc.req, resp, tc.err); got != tc.want {
+			t.Errorf("%s %d %v: got class %d, expected %d", tc.req.Method, tc.status, tc.err, got, tc.want)
+		}
+	}
+
+	if !d.Retry(2, ErrorTransient) || d.Retry(3, ErrorTransient) {
+		t.Errorf("expected 3 retries")
+	}
+	for retries, want := range []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second} {
+		if got := d.Delay(retries, ErrorTransient, nil); got != want {
+			t.Errorf("delay after %d retries: got %s, expected %s", retries, got, want)
+		}
+	}
+	if got := d.Delay(20, ErrorTransient, nil); got != defaultRetryMaxDelay {
+		t.Errorf("delay was not capped: %s", got)
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if got := d.Delay(0, ErrorThrottled, resp); got != 3*time.Second+defaultRetryBaseDelay {
+		t.Errorf("Retry-After was not honoured: %s", got)
+	}
+
+	d.Jitter = nil
+	for i := 0; i < 100; i++ {
+		if got := d.Delay(2, ErrorTransient, nil); got < 0 || got > time.Second {
+			t.Fatalf("jittered delay out of range: %s", got)
+		}
+		if got := d.Delay(0, ErrorThrottled, resp); got < 3*time.Second || got > 3*time.Second+defaultRetryBaseDelay {
+			t.Fatalf("jittered Retry-After out of range: %s", got)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var attempts, failing int32 = 0, 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	p := &Provider{BreakerThreshold: 2, BreakerCooldown: time.Minute}
+	rt, b := p.buildTransport(p.ServerURL, p.TokenSource)
+	hc := &http.Client{Transport: rt}
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	get := func() error {
+		resp, err := hc.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := b.stats(); s.State != CircuitOpen || s.Opened != 1 {
+		t.Fatalf("expected the circuit to open, got %+v", s)
+	}
+	var open *CircuitOpenError
+	if err := get(); !errors.As(err, &open) {
+		t.Fatalf("expected a CircuitOpenError, got %v", err)
+	}
+	if attempts != 2 || b.stats().Rejected != 1 {
+		t.Errorf("the open circuit let a request through")
+	}
+
+	// a failed trial opens the circuit again
+	now = now.Add(time.Minute)
+	if s := b.stats(); s.State != CircuitHalfOpen {
+		t.Fatalf("expected a half-open circuit, got %s", s.State)
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.stats(); s.State != CircuitOpen || s.Opened != 2 {
+		t.Fatalf("expected the circuit to open again, got %+v", s)
+	}
+
+	now = now.Add(time.Minute)
+	atomic.StoreInt32(&failing, 0)
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.stats(); s.State != CircuitClosed || s.Failures != 0 {
+		t.Errorf("expected the circuit to close, got %+v", s)
+	}
+}
+
+func TestProviderDialContext(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	addr := strings.TrimPrefix(fs.URL, "http://")
+	var dialed []string
+	p := fs.provider()
+	p.ServerURL = "http://pdns.internal.invalid:8081"
+	p.DialContext = func(ctx context.Context, network, a string) (net.Conn, error) {
+		dialed = append(dialed, a)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	if _, err := p.GetRecords(context.Background(), "example.org."); err != nil {
+		t.Fatal(err)
+	}
+	if len(dialed) == 0 || dialed[0] != "pdns.internal.invalid:8081" {
+		t.Errorf("DialContext was not used: %v", dialed)
+	}
+
+	p = &Provider{Resolver: &net.Resolver{PreferGo: true}}
+	tr, ok := p.testTransport().(*http.Transport)
+	if !ok || tr.DialContext == nil {
+		t.Errorf("expected a transport dialing with the resolver, got %#v", p.testTransport())
+	}
+}
+
+// testTransport returns the round tripper the provider's client would use.
+func (p *Provider) testTransport() http.RoundTripper {
+	rt, _ := p.buildTransport(p.ServerURL, p.TokenSource)
+	return rt
+}
@@ -0,0 +1,123 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+const (
+	// TTLPolicyError rejects records for the same name and type that
+	// have different TTLs.
+	TTLPolicyError = "error"
+	// TTLPolicyFirst uses the TTL of the first record of an RRset.
+	TTLPolicyFirst = "first"
+	// TTLPolicyMin uses the lowest TTL given for an RRset.
+	TTLPolicyMin = "min"
+	// TTLPolicyMax uses the highest TTL given for an RRset.
+	TTLPolicyMax = "max"
+)
+
+// resolveTTLs gives all records of an RRset the same TTL according to
+// TTLPolicy, as PowerDNS only stores one TTL per RRset.  Records without a
+// value don't take part.
+func (p *Provider) resolveTTLs(zone string, records []libdns.Record) ([]libdns.Record, error) {
+	policy := p.TTLPolicy
+	if policy == "" {
+		policy = TTLPolicyError
+	}
+	abs := convertNamesToAbsolute(zone, records)
+	ttls := make(map[string]time.Duration)
+	for _, rec := range abs {
+		if rec.Value == "" {
+			continue
+		}
+		k := key(rec.Name, rec.Type)
+		ttl, ok := ttls[k]
+		if !ok || ttl == rec.TTL {
+			ttls[k] = rec.TTL
+			continue
+		}
+		switch policy {
+		case TTLPolicyError:
+			return nil, fmt.Errorf("conflicting TTLs %s and %s for %s record %s", ttl, rec.TTL, rec.Type, rec.Name)
+		case TTLPolicyFirst:
+		case TTLPolicyMin:
+			if rec.TTL < ttl {
+				ttls[k] = rec.TTL
+			}
+		case TTLPolicyMax:
+			if rec.TTL > ttl {
+				ttls[k] = rec.TTL
+			}
+		default:
+			return nil, fmt.Errorf("unknown TTL policy %q", p.TTLPolicy)
+		}
+	}
+	var out []libdns.Record
+	for i, rec := range abs {
+		if rec.Value == "" {
+			continue
+		}
+		if ttl := ttls[key(rec.Name, rec.Type)]; ttl != rec.TTL {
+			if out == nil {
+				out = append([]libdns.Record(nil), records...)
+			}
+			out[i].TTL = ttl
+		}
+	}
+	if out == nil {
+		return records, nil
+	}
+	return out, nil
+}
+
+// SetZoneTTL changes the TTL of every RRset in the zone that filter
+// matches, in a single patch, leaving the records themselves alone.  This
+// is the usual step before migrating a zone.  The records whose TTL
+// changed are returned.
+func (p *Provider) SetZoneTTL(ctx context.Context, zone string, ttl time.Duration, filter RecordFilter) ([]libdns.Record, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	secs := int(ttl / time.Second)
+	if secs <= 0 {
+		return nil, fmt.Errorf("invalid TTL %s", ttl)
+	}
+	defer p.lockZone(zone)()
+
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	fullZone, err := c.fullZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var rRSets []zones.ResourceRecordSet
+	var changed []libdns.Record
+	for _, t := range fullZone.ResourceRecordSets {
+		rec := libdns.Record{Name: libdns.RelativeName(t.Name, zone), Type: t.Type}
+		if t.TTL == secs || len(t.Records) == 0 || !filter.match(rec) {
+			continue
+		}
+		rr := t
+		rr.ChangeType = zones.ChangeTypeReplace
+		rr.TTL = secs
+		rRSets = append(rRSets, rr)
+		changed = appendLDRecords(changed, zone, rr)
+	}
+	if len(rRSets) == 0 {
+		return nil, nil
+	}
+	if err := p.checkOwnership(fullZone, rRSets); err != nil {
+		return nil, err
+	}
+	p.annotate(fullZone, rRSets)
+	if err := p.updateRRs(ctx, c, zone, fullZone.ID, rRSets); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
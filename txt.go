@@ -0,0 +1,144 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// maxTXTString is the longest character-string a TXT record can hold.
+const maxTXTString = 255
+
+// hasTXTContent reports whether the content of rrType records is a list of
+// character-strings.
+func hasTXTContent(rrType string) bool {
+	return rrType == "TXT" || rrType == "SPF"
+}
+
+// chunkTXT splits the character-strings of TXT content that are too long
+// into pieces of 255 bytes, as longer strings can't be stored.  Content
+// that isn't quoted is taken as a single string and quoted if it needs to
+// be split.  Content that needs no splitting, or can't be parsed, is
+// returned as is.
+func chunkTXT(value string) string {
+	strs, ok := parseTXT(value)
+	if !ok {
+		if strings.HasPrefix(value, `"`) {
+			return value
+		}
+		strs = []string{value}
+	}
+	long := false
+	for _, s := range strs {
+		long = long || len(s) > maxTXTString
+	}
+	if !long {
+		return value
+	}
+	var parts []string
+	for _, s := range strs {
+		for len(s) > maxTXTString {
+			parts = append(parts, encodeTXTString(s[:maxTXTString]))
+			s = s[maxTXTString:]
+		}
+		parts = append(parts, encodeTXTString(s))
+	}
+	return strings.Join(parts, " ")
+}
+
+// joinTXT reassembles TXT content that chunkTXT split, or that was split
+// the same way, into a single quoted string.  Content is only joined if
+// every string but the last is 255 bytes long, since separate shorter
+// strings are meant to be separate.
+func joinTXT(value string) string {
+	strs, ok := parseTXT(value)
+	if !ok || len(strs) < 2 {
+		return value
+	}
+	for _, s := range strs[:len(strs)-1] {
+		if len(s) != maxTXTString {
+			return value
+		}
+	}
+	return encodeTXTString(strings.Join(strs, ""))
+}
+
+// quoteTXTValues quotes the TXT values of records that callers left
+// unquoted, the way they are stored and served.
+func quoteTXTValues(records []libdns.Record) []libdns.Record {
+	for i, rec := range records {
+		if !hasTXTContent(rec.Type) || rec.Value == "" {
+			continue
+		}
+		if _, ok := parseTXT(rec.Value); !ok && !strings.HasPrefix(rec.Value, `"`) {
+			records[i].Value = encodeTXTString(rec.Value)
+		}
+	}
+	return records
+}
+
+// parseTXT splits TXT content into its decoded character-strings.  It
+// reports false if the content isn't a list of quoted strings.
+func parseTXT(value string) ([]string, bool) {
+	var strs []string
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		if rest[0] != '"' {
+			return nil, false
+		}
+		var b strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] != '\\' {
+				b.WriteByte(rest[i])
+				continue
+			}
+			i++
+			if i == len(rest) {
+				return nil, false
+			}
+			if i+2 < len(rest) && isDigit(rest[i]) && isDigit(rest[i+1]) && isDigit(rest[i+2]) {
+				n := int(rest[i]-'0')*100 + int(rest[i+1]-'0')*10 + int(rest[i+2]-'0')
+				if n > 255 {
+					return nil, false
+				}
+				b.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+			b.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return nil, false
+		}
+		strs = append(strs, b.String())
+		rest = strings.TrimLeft(rest[i+1:], " \t")
+	}
+	return strs, len(strs) > 0
+}
+
+// encodeTXTString quotes s as a character-string, escaping quotes,
+// backslashes and unprintable bytes.
+func encodeTXTString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,45 @@
+package pdnsprovider
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunkTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for _, table := range []struct {
+		in, want string
+	}{
+		{`"short"`, `"short"`},
+		{`unquoted`, `unquoted`},
+		{`"a" "b"`, `"a" "b"`},
+		{`"` + long + `"`, `"` + long[:255] + `" "` + long[255:] + `"`},
+		{long, `"` + long[:255] + `" "` + long[255:] + `"`},
+		{`"x" "` + long + `"`, `"x" "` + long[:255] + `" "` + long[255:] + `"`},
+		{`"` + strings.Repeat(`\"`, 256) + `"`, `"` + strings.Repeat(`\"`, 255) + `" "\""`},
+		{`"unterminated`, `"unterminated`},
+	} {
+		if got := chunkTXT(table.in); got != table.want {
+			t.Errorf("chunkTXT(%.20q...): got %q, expected %q", table.in, got, table.want)
+		}
+	}
+}
+
+func TestJoinTXT(t *testing.T) {
+	long := strings.Repeat("b", 600)
+	chunked := chunkTXT(long)
+	if got := joinTXT(chunked); got != `"`+long+`"` {
+		t.Errorf("chunked content was not joined: %q", got)
+	}
+	if got := chunkTXT(joinTXT(chunked)); got != chunked {
+		t.Errorf("joined content doesn't chunk the same way: %q", got)
+	}
+	for _, v := range []string{`"a" "b"`, `"short"`, `not quoted`, `"\255\000"`} {
+		if got := joinTXT(v); got != v {
+			t.Errorf("joinTXT(%q) = %q, expected it unchanged", v, got)
+		}
+	}
+	if strs, ok := parseTXT(`"a\"b" "c\\d" "\065"`); !ok || strings.Join(strs, "|") != `a"b|c\d|A` {
+		t.Errorf("unexpected parse %q, %t", strs, ok)
+	}
+}
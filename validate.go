@@ -0,0 +1,100 @@
+package pdnsprovider
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// validateRecords checks the content of records of the common types before
+// they are submitted, so that mistakes are reported with the offending
+// record instead of as the API's rejection of the whole patch.  Records
+// without a value and of other types are not checked.
+func (p *Provider) validateRecords(records []libdns.Record) error {
+	// the legacy API stores names without the trailing dot
+	fqdn := !p.LegacyAPI
+	for _, rec := range records {
+		if rec.Value == "" {
+			continue
+		}
+		if err := validateContent(rec.Type, rec.Value, fqdn); err != nil {
+			return fmt.Errorf("invalid %s record %s: %s", rec.Type, rec.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateContent checks value as content of an rrType record.  With fqdn
+// set, target names must end with a dot.
+func validateContent(rrType, value string, fqdn bool) error {
+	fields := strings.Fields(value)
+	switch rrType {
+	case "A":
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%q is not an IPv4 address", value)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(value); ip == nil || !strings.Contains(value, ":") {
+			return fmt.Errorf("%q is not an IPv6 address", value)
+		}
+	case "CNAME", "DNAME", "NS", "PTR":
+		return validateTarget(value, fqdn)
+	case "MX":
+		if len(fields) != 2 {
+			return fmt.Errorf("%q is not in the form \"preference target.\"", value)
+		}
+		if err := validateUint(fields[0], "preference", 16); err != nil {
+			return err
+		}
+		return validateTarget(fields[1], fqdn)
+	case "SRV":
+		if len(fields) != 4 {
+			return fmt.Errorf("%q is not in the form \"priority weight port target.\"", value)
+		}
+		for i, name := range []string{"priority", "weight", "port"} {
+			if err := validateUint(fields[i], name, 16); err != nil {
+				return err
+			}
+		}
+		return validateTarget(fields[3], fqdn)
+	case "CAA":
+		if len(fields) < 3 {
+			return fmt.Errorf("%q is not in the form \"flags tag \\\"value\\\"\"", value)
+		}
+		if err := validateUint(fields[0], "flags", 8); err != nil {
+			return err
+		}
+		for _, r := range fields[1] {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return fmt.Errorf("tag %q must be alphanumeric", fields[1])
+			}
+		}
+		if v := strings.Join(fields[2:], " "); len(v) < 2 || !strings.HasPrefix(v, `"`) || !strings.HasSuffix(v, `"`) {
+			return fmt.Errorf("value %s must be quoted", v)
+		}
+	}
+	return nil
+}
+
+// validateTarget checks that target is a domain name, fully qualified if
+// fqdn is set, as PowerDNS requires in record content.
+func validateTarget(target string, fqdn bool) error {
+	if _, ok := dns.IsDomainName(target); !ok {
+		return fmt.Errorf("target %q is not a valid domain name", target)
+	}
+	if fqdn && !strings.HasSuffix(target, ".") {
+		return fmt.Errorf("target %q must be fully qualified, with a trailing dot", target)
+	}
+	return nil
+}
+
+func validateUint(s, field string, bits int) error {
+	if _, err := strconv.ParseUint(s, 10, bits); err != nil {
+		return fmt.Errorf("%s %q must be a number below %d", field, s, 1<<bits)
+	}
+	return nil
+}
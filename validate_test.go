@@ -0,0 +1,38 @@
+package pdnsprovider
+
+import "testing"
+
+func TestValidateContent(t *testing.T) {
+	for _, table := range []struct {
+		rrType, value string
+		valid         bool
+	}{
+		{"A", "192.0.2.1", true},
+		{"A", "2001:db8::1", false},
+		{"A", "192.0.2", false},
+		{"AAAA", "2001:db8::1", true},
+		{"AAAA", "192.0.2.1", false},
+		{"CNAME", "www.example.org.", true},
+		{"CNAME", "www.example.org", false},
+		{"CNAME", "www..example.org.", false},
+		{"MX", "10 mail.example.org.", true},
+		{"MX", "0 .", true},
+		{"MX", "mail.example.org.", false},
+		{"MX", "70000 mail.example.org.", false},
+		{"SRV", "10 5 443 web.example.org.", true},
+		{"SRV", "10 5 https web.example.org.", false},
+		{"SRV", "10 5 443", false},
+		{"CAA", `0 issue "letsencrypt.org"`, true},
+		{"CAA", `0 issue letsencrypt.org`, false},
+		{"CAA", `256 issue "letsencrypt.org"`, false},
+		{"TXT", `"anything goes"`, true},
+	} {
+		err := validateContent(table.rrType, table.value, true)
+		if table.valid && err != nil {
+			t.Errorf("%s %q: unexpected error: %s", table.rrType, table.value, err)
+		}
+		if !table.valid && err == nil {
+			t.Errorf("%s %q: expected an error", table.rrType, table.value)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// verifyRRSets reads back the RRsets in want and returns an error if the
+// server's data differs from them.
+func (c *client) verifyRRSets(ctx context.Context, zoneID string, want []zones.ResourceRecordSet) error {
+	have := make(map[string]*zones.ResourceRecordSet, len(want))
+	if c.direct {
+		for _, rr := range want {
+			got, err := c.getRRSet(ctx, zoneID, rr.Name, rr.Type)
+			if err != nil {
+				return err
+			}
+			have[key(rr.Name, rr.Type)] = got
+		}
+	} else {
+		z, err := c.zones.GetZone(ctx, c.sID, zoneID)
+		if err != nil {
+			return err
+		}
+		for i := range z.ResourceRecordSets {
+			rr := &z.ResourceRecordSets[i]
+			have[key(rr.Name, rr.Type)] = rr
+		}
+	}
+	for _, rr := range want {
+		got := have[key(rr.Name, rr.Type)]
+		if rr.ChangeType == zones.ChangeTypeDelete || len(rr.Records) == 0 {
+			if got != nil && len(got.Records) > 0 {
+				return fmt.Errorf("verification of %s %s failed: RRset still exists with %s", rr.Name, rr.Type, strings.Join(recordStrings(got.Records), ", "))
+			}
+			continue
+		}
+		if got == nil {
+			return fmt.Errorf("verification of %s %s failed: RRset does not exist", rr.Name, rr.Type)
+		}
+		if !rrsetEqual(*got, rr) {
+			return fmt.Errorf("verification of %s %s failed: server has TTL %d with %s, want TTL %d with %s",
+				rr.Name, rr.Type, got.TTL, strings.Join(recordStrings(got.Records), ", "),
+				rr.TTL, strings.Join(recordStrings(rr.Records), ", "))
+		}
+	}
+	return nil
+}
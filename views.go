@@ -0,0 +1,85 @@
+package pdnsprovider
+
+import (
+	"context"
+	"strings"
+)
+
+// variantSeparator separates a zone name from its variant name.
+const variantSeparator = ".."
+
+// variantName maps zone to the variant selected by the client's view.  Names
+// that already carry a variant are returned unchanged.
+func (c *client) variantName(zone string) string {
+	if c.view == "" || strings.Contains(zone, variantSeparator) {
+		return zone
+	}
+	return strings.TrimSuffix(zone, ".") + variantSeparator + c.view
+}
+
+// ListViews returns the names of the views defined on the server.
+func (p *Provider) ListViews(ctx context.Context) ([]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Views []string `json:"views"`
+	}
+	err = c.do(ctx, "GET", c.serverPath("views"), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Views, nil
+}
+
+// ViewZones returns the zones and zone variants that make up view.
+func (p *Provider) ViewZones(ctx context.Context, view string) ([]string, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.client()
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Zones []string `json:"zones"`
+	}
+	err = c.do(ctx, "GET", c.serverPath("views", view), nil, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Zones, nil
+}
+
+// AddZoneToView adds zone to view.  zone may name a variant, such as
+// "example.org..internal", or a plain zone.
+func (p *Provider) AddZoneToView(ctx context.Context, view, zone string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	in := struct {
+		Name string `json:"name"`
+	}{zone}
+	if err := c.do(ctx, "POST", c.serverPath("views", view), nil, in, nil); err != nil {
+		return err
+	}
+	// the zone may now be the variant the client looks up
+	c.missing.forget(c.variantName(zone))
+	return nil
+}
+
+// RemoveZoneFromView removes zone from view.
+func (p *Provider) RemoveZoneFromView(ctx context.Context, view, zone string) error {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", c.serverPath("views", view, zone), nil, nil, nil)
+}
@@ -0,0 +1,142 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// WaitOptions configures WaitForRecords.
+type WaitOptions struct {
+	// Resolvers are the host:port addresses to query.  They default to
+	// the addresses of the zone's authoritative nameservers.
+	Resolvers []string
+
+	// Recursive sets the RD bit on queries, for Resolvers that are
+	// recursive resolvers rather than authoritative servers.
+	Recursive bool
+
+	// Timeout bounds the wait.  0 relies solely on ctx for cancellation.
+	Timeout time.Duration
+
+	// Interval is how long to sleep between rounds of queries.  It
+	// defaults to the interval WaitForPropagation uses.
+	Interval time.Duration
+}
+
+// ResolverStatus reports which of the awaited records one resolver serves.
+type ResolverStatus struct {
+	// Server is the host:port that was queried.
+	Server string
+
+	// Missing describes the records the server doesn't serve yet.
+	Missing []string
+
+	// Err is the error querying the server, if any.
+	Err error
+}
+
+// Ready reports whether the server serves all of the records.
+func (s ResolverStatus) Ready() bool {
+	return s.Err == nil && len(s.Missing) == 0
+}
+
+// WaitForRecords polls each resolver of opts until all of them resolve
+// every one of records, so that automation depending on the records can be
+// sequenced after them.  Records are compared the way they are written, so
+// MX and SRV priorities and long TXT values may be given as for
+// AppendRecords.  The last status of every resolver is returned, along
+// with an error naming the ones that weren't ready in time.
+func (p *Provider) WaitForRecords(ctx context.Context, zone string, records []libdns.Record, opts WaitOptions) ([]ResolverStatus, error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = propagationInterval
+	}
+	servers := opts.Resolvers
+	if len(servers) == 0 {
+		c, err := p.clientFor(zone)
+		if err != nil {
+			return nil, err
+		}
+		servers, err = c.nameserverAddrs(ctx, zone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	records = expectedRecords(zone, records)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var statuses []ResolverStatus
+	for {
+		round := make([]ResolverStatus, len(servers))
+		var pending []string
+		for i, server := range servers {
+			round[i] = resolverStatus(ctx, server, records, opts.Recursive)
+			// a query cut short by the deadline tells nothing new
+			if round[i].Err != nil && expired(ctx) && statuses != nil {
+				round[i] = statuses[i]
+			}
+			if !round[i].Ready() {
+				pending = append(pending, server)
+			}
+		}
+		statuses = round
+		if len(pending) == 0 {
+			return statuses, nil
+		}
+		select {
+		case <-ctx.Done():
+			return statuses, fmt.Errorf("records not resolvable on %s: %s", strings.Join(pending, ", "), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// expired reports whether ctx is done or its deadline has passed, which
+// fails queries a moment before ctx is done.
+func expired(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// expectedRecords brings records into the form resolvers present them in:
+// names are made absolute, priorities are moved into the values and TXT
+// values are quoted, and split if they are too long.
+func expectedRecords(zone string, records []libdns.Record) []libdns.Record {
+	return quoteTXTValues(convertNamesToAbsolute(zone, normalizeRecords(records)))
+}
+
+// resolverStatus queries server for each of records.
+func resolverStatus(ctx context.Context, server string, records []libdns.Record, recurse bool) ResolverStatus {
+	status := ResolverStatus{Server: server}
+	answers := make(map[string][]string)
+	for _, rec := range records {
+		k := key(rec.Name, rec.Type)
+		values, ok := answers[k]
+		if !ok {
+			var err error
+			values, err = queryValues(ctx, server, rec.Name, rec.Type, recurse)
+			if err != nil {
+				status.Err = err
+				return status
+			}
+			answers[k] = values
+		}
+		if !containsValue(values, rec.Value) {
+			status.Missing = append(status.Missing, fmt.Sprintf("%s %s %s", rec.Name, rec.Type, rec.Value))
+		}
+	}
+	return status
+}
@@ -0,0 +1,152 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/miekg/dns"
+)
+
+// fakeResolver answers queries from the records it was given, in zone file
+// format.
+type fakeResolver struct {
+	mu  sync.Mutex
+	rrs []dns.RR
+}
+
+// startResolver serves rrs over UDP on a local port and returns the server
+// along with its address.
+func startResolver(t *testing.T, rrs ...string) (*fakeResolver, string) {
+	t.Helper()
+	fr := &fakeResolver{}
+	fr.add(t, rrs...)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: fr, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return fr, pc.LocalAddr().String()
+}
+
+// add makes the server answer with rrs as well.
+func (fr *fakeResolver) add(t *testing.T, rrs ...string) {
+	t.Helper()
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("invalid record %q: %s", s, err)
+		}
+		fr.rrs = append(fr.rrs, rr)
+	}
+}
+
+func (fr *fakeResolver) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+	q := req.Question[0]
+	for _, rr := range fr.rrs {
+		if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func TestWaitForRecords(t *testing.T) {
+	long := strings.Repeat("0123456789", 30)
+	_, addr := startResolver(t,
+		`_acme-challenge.example.org. 60 IN TXT "token"`,
+		`long.example.org. 60 IN TXT "`+long[:255]+`" "`+long[255:]+`"`,
+		`example.org. 3600 IN MX 10 mail.example.org.`,
+		`www.example.org. 300 IN A 192.0.2.1`,
+	)
+	p := &Provider{}
+	records := []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "token"},
+		{Name: "long", Type: "txt", Value: long},
+		{Name: "@", Type: "MX", Value: "mail.example.org", Priority: 10},
+		{Name: "www", Type: "A", Value: "192.0.2.1"},
+	}
+	statuses, err := p.WaitForRecords(context.Background(), "example.org.", records, WaitOptions{
+		Resolvers: []string{addr},
+		Timeout:   5 * time.Second,
+		Interval:  10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("WaitForRecords failed: %s", err)
+	}
+	if len(statuses) != 1 || !statuses[0].Ready() || statuses[0].Server != addr {
+		t.Errorf("unexpected statuses %#v", statuses)
+	}
+}
+
+func TestWaitForRecordsPending(t *testing.T) {
+	fr, addr := startResolver(t)
+	p := &Provider{}
+	records := []libdns.Record{{Name: "_acme-challenge", Type: "TXT", Value: "token"}}
+	opts := WaitOptions{
+		Resolvers: []string{addr},
+		Timeout:   50 * time.Millisecond,
+		Interval:  10 * time.Millisecond,
+	}
+
+	statuses, err := p.WaitForRecords(context.Background(), "example.org.", records, opts)
+	if err == nil || !strings.Contains(err.Error(), addr) {
+		t.Errorf("expected an error naming the resolver, got %v", err)
+	}
+	if len(statuses) != 1 || len(statuses[0].Missing) != 1 || !strings.Contains(statuses[0].Missing[0], `"token"`) {
+		t.Errorf("unexpected statuses %#v", statuses)
+	}
+
+	// records that show up while waiting end the wait
+	time.AfterFunc(30*time.Millisecond, func() {
+		fr.add(t, `_acme-challenge.example.org. 60 IN TXT "token"`)
+	})
+	opts.Timeout = 5 * time.Second
+	if _, err := p.WaitForRecords(context.Background(), "example.org.", records, opts); err != nil {
+		t.Errorf("WaitForRecords failed: %s", err)
+	}
+}
+
+func TestProviderWaitForSecondaries(t *testing.T) {
+	fs := newFakeServer(t, testZone())
+	_, stale := startResolver(t, `example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 2021010101 10800 3600 604800 3600`)
+	_, edited := startResolver(t, `example.org. 3600 IN SOA ns1.example.org. hostmaster.example.org. 2021010105 10800 3600 604800 3600`)
+	p := fs.provider()
+	p.Secondaries = []string{stale}
+	ctx := context.Background()
+
+	if _, err := p.WaitForSecondaries(ctx, "example.org.", time.Second); err != nil {
+		t.Errorf("expected the secondary to be in sync, got %s", err)
+	}
+
+	// with SOA-EDIT the secondaries serve the edited serial
+	fs.mu.Lock()
+	fs.editedSerial["example.org."] = 2021010105
+	fs.mu.Unlock()
+	statuses, err := p.WaitForSecondaries(ctx, "example.org.", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "2021010105") {
+		t.Errorf("expected the secondary to lag behind the edited serial, got %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].Behind(2021010105) != 4 {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+	p.Secondaries = []string{edited}
+	if _, err := p.WaitForSecondaries(ctx, "example.org.", time.Second); err != nil {
+		t.Errorf("expected the secondary to serve the edited serial, got %s", err)
+	}
+}
@@ -0,0 +1,119 @@
+package pdnsprovider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ZoneEvent describes a change to a watched zone.
+type ZoneEvent struct {
+	Zone      string
+	OldSerial int
+	Serial    int
+
+	// Changes lists the RRsets that differ between the two serials.
+	// ChangeDelete entries carry the removed RRset.
+	Changes []Change
+}
+
+// WatchZone polls the zone's serial every interval and calls fn with the
+// differences whenever it changes.  Transient API errors are skipped over.
+// WatchZone blocks until ctx is done and returns ctx.Err(), or returns early
+// if the zone can't be fetched initially or interval isn't positive.
+func (p *Provider) WatchZone(ctx context.Context, zone string, interval time.Duration, fn func(ZoneEvent)) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid watch interval %s", interval)
+	}
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return err
+	}
+	last, err := c.fullZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		short, err := c.shortZone(ctx, zone)
+		if err != nil || short.Serial == last.Serial {
+			continue
+		}
+		cur, err := c.fullZone(ctx, zone)
+		if err != nil {
+			continue
+		}
+		fn(ZoneEvent{
+			Zone:      zone,
+			OldSerial: last.Serial,
+			Serial:    cur.Serial,
+			Changes:   diffZones(last, cur),
+		})
+		last = cur
+	}
+}
+
+// diffZones returns the RRset changes that turn old into cur.
+func diffZones(old, cur *zones.Zone) []Change {
+	before := make(map[string]*zones.ResourceRecordSet, len(old.ResourceRecordSets))
+	for i := range old.ResourceRecordSets {
+		rr := &old.ResourceRecordSets[i]
+		before[key(rr.Name, rr.Type)] = rr
+	}
+	var changes []Change
+	for _, rr := range cur.ResourceRecordSets {
+		k := key(rr.Name, rr.Type)
+		prev, ok := before[k]
+		delete(before, k)
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeAdd, RRSet: rr})
+		case !rrsetEqual(*prev, rr):
+			changes = append(changes, Change{Kind: ChangeReplace, RRSet: rr, Existing: prev})
+		}
+	}
+	for _, rr := range old.ResourceRecordSets {
+		if prev, ok := before[key(rr.Name, rr.Type)]; ok {
+			changes = append(changes, Change{Kind: ChangeDelete, RRSet: *prev, Existing: prev})
+		}
+	}
+	return changes
+}
+
+// rrsetEqual reports whether a and b have the same TTL and records,
+// regardless of record order.
+func rrsetEqual(a, b zones.ResourceRecordSet) bool {
+	if a.TTL != b.TTL || len(a.Records) != len(b.Records) {
+		return false
+	}
+	as := recordStrings(a.Records)
+	bs := recordStrings(b.Records)
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func recordStrings(recs []zones.Record) []string {
+	out := make([]string, 0, len(recs))
+	for _, r := range recs {
+		s := r.Content
+		if r.Disabled {
+			s = "!" + s
+		}
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
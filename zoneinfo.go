@@ -0,0 +1,111 @@
+package pdnsprovider
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/mittwald/go-powerdns/apis/zones"
+)
+
+// ZoneInfo holds the zone level details the server keeps about a zone.
+type ZoneInfo struct {
+	ID   string
+	Name string
+	Kind zones.ZoneKind
+
+	// Serial is the SOA serial, NotifiedSerial the serial secondaries
+	// were last notified of and EditedSerial the serial the SOA-EDIT
+	// setting makes the server serve.
+	Serial         uint32
+	NotifiedSerial uint32
+	EditedSerial   uint32
+
+	// Masters are the primaries of a secondary zone.
+	Masters []string
+
+	DNSSec      bool
+	NSEC3Param  string
+	NSEC3Narrow bool
+	Presigned   bool
+	APIRectify  bool
+	SOAEdit     string
+	SOAEditAPI  string
+	Account     string
+
+	// LastCheck is when a secondary zone was last checked for changes
+	// at its primaries, and zero if it never was.
+	LastCheck time.Time
+}
+
+// GetZoneInfo returns the zone level details of zone, without its records.
+// Servers reached through ZoneClient or the legacy API only report the
+// details their zone listing has.
+func (p *Provider) GetZoneInfo(ctx context.Context, zone string) (*ZoneInfo, error) {
+	ctx, cancel := p.withDeadline(ctx)
+	defer cancel()
+	c, err := p.clientFor(zone)
+	if err != nil {
+		return nil, err
+	}
+	z, err := c.shortZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if !c.direct {
+		return &ZoneInfo{
+			ID:             z.ID,
+			Name:           z.Name,
+			Kind:           z.Kind,
+			Serial:         uint32(z.Serial),
+			NotifiedSerial: uint32(z.NotifiedSerial),
+			Masters:        z.Masters,
+			DNSSec:         z.DNSSec,
+			Account:        z.Account,
+		}, nil
+	}
+
+	var out struct {
+		ID             string         `json:"id"`
+		Name           string         `json:"name"`
+		Kind           zones.ZoneKind `json:"kind"`
+		Serial         uint32         `json:"serial"`
+		NotifiedSerial uint32         `json:"notified_serial"`
+		EditedSerial   uint32         `json:"edited_serial"`
+		Masters        []string       `json:"masters"`
+		DNSSec         bool           `json:"dnssec"`
+		NSEC3Param     string         `json:"nsec3param"`
+		NSEC3Narrow    bool           `json:"nsec3narrow"`
+		Presigned      bool           `json:"presigned"`
+		APIRectify     bool           `json:"api_rectify"`
+		SOAEdit        string         `json:"soa_edit"`
+		SOAEditAPI     string         `json:"soa_edit_api"`
+		Account        string         `json:"account"`
+		LastCheck      int64          `json:"last_check"`
+	}
+	q := url.Values{"rrsets": {"false"}}
+	if err := c.do(ctx, "GET", c.serverPath("zones", z.ID), q, nil, &out); err != nil {
+		return nil, err
+	}
+	info := &ZoneInfo{
+		ID:             out.ID,
+		Name:           out.Name,
+		Kind:           out.Kind,
+		Serial:         out.Serial,
+		NotifiedSerial: out.NotifiedSerial,
+		EditedSerial:   out.EditedSerial,
+		Masters:        out.Masters,
+		DNSSec:         out.DNSSec,
+		NSEC3Param:     out.NSEC3Param,
+		NSEC3Narrow:    out.NSEC3Narrow,
+		Presigned:      out.Presigned,
+		APIRectify:     out.APIRectify,
+		SOAEdit:        out.SOAEdit,
+		SOAEditAPI:     out.SOAEditAPI,
+		Account:        out.Account,
+	}
+	if out.LastCheck > 0 {
+		info.LastCheck = time.Unix(out.LastCheck, 0)
+	}
+	return info, nil
+}